@@ -0,0 +1,959 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// folds the items in the from, to window into acc, oldest first, giving
+// step the running value, each item's time and the item. the primitive the
+// window aggregations are built on, for statistics they don't cover; a
+// function rather than a method so the accumulator can have its own type.
+// an empty window gives acc back unchanged.
+func Fold[T any, A any](l *History[T], from time.Time, to time.Time, acc A, step func(acc A, t time.Time, it T) A) (_ A, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("Fold", time.Now())
+	}
+
+	lo, hi := l.window(from, to)
+	return fold(context.Background(), l, lo, hi, acc, step)
+}
+
+// caller holds the lock. Fold over indexes [lo, hi) of times, giving up
+// with ctx's error once ctx is done, checked every ctxCheckEvery items
+func fold[T any, A any](ctx context.Context, l *History[T], lo int, hi int, acc A, step func(acc A, t time.Time, it T) A) (A, error) {
+	for i := lo; i < hi; i++ {
+		if (i-lo)%ctxCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return acc, err
+			}
+		}
+		acc = step(acc, l.times[i], l.t[l.times[i]])
+	}
+	return acc, nil
+}
+
+// sum of items in the from, to window, starting from the zero value of T.
+// an empty window sums to the zero value.
+func (l *History[T]) SumBetween(from time.Time, to time.Time, sum func(a T, b T) T) (T, error) {
+	var zero T
+	return Fold(l, from, to, zero, func(cum T, _ time.Time, it T) T { return sum(cum, it) })
+}
+
+// same as NumItemsBetween, named to go with SumBetween and AvgBetween
+func (l *History[T]) CountBetween(from time.Time, to time.Time) (int, error) {
+	return l.NumItemsBetween(from, to)
+}
+
+// summary of a window from WindowStats
+type Stats[T any] struct {
+	Count int
+	Sum   T // starting from the zero value of T
+	Min   T // the earliest of equal items
+	Max   T
+	Avg   T        // Sum divided by Count
+	First Entry[T] // oldest entry in the window
+	Last  Entry[T] // newest entry in the window
+}
+
+// count, sum, min, max, average and the end entries of the from, to window
+// in a single pass. all of sum, less and div are required. ErrNoValues for
+// an empty window.
+func (l *History[T]) WindowStats(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	less func(a T, b T) bool,
+	div func(a T, n int) T,
+) (_ Stats[T], err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if lo == hi {
+		return Stats[T]{}, ErrNoValues
+	}
+
+	first := l.t[l.times[lo]]
+	st := Stats[T]{Min: first, Max: first}
+	for i := lo; i < hi; i++ {
+		it := l.t[l.times[i]]
+		st.Sum = sum(st.Sum, it)
+		if less(it, st.Min) {
+			st.Min = it
+		}
+		if less(st.Max, it) {
+			st.Max = it
+		}
+	}
+	st.Count = hi - lo
+	st.Avg = div(st.Sum, st.Count)
+	st.First = l.entryAt(l.times[lo])
+	st.Last = l.entryAt(l.times[hi-1])
+	return st, nil
+}
+
+// number of distinct keys among the items in the from, to window, counted
+// exactly with a set of the keys. like NumItemsBetween it errors with
+// ErrEmpty for an empty log. an approximate count in bounded memory, say by
+// HyperLogLog, would suit windows too big for the set.
+func (l *History[T]) DistinctCountBetween(from time.Time, to time.Time, key func(it T) string) (_ int, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return 0, ErrEmpty
+	}
+
+	seen := make(map[string]struct{})
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		seen[key(l.t[l.times[i]])] = struct{}{}
+	}
+	return len(seen), nil
+}
+
+// most frequent key among the items in the from, to window, given as the
+// first item with that key, with how many items have it. a tie goes to the
+// key that occurs first in the window. ErrNoValues for an empty window.
+func (l *History[T]) ModeBetween(from time.Time, to time.Time, key func(it T) string) (_ T, _ int, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	type tally struct {
+		first T
+		n     int
+		order int
+	}
+	var best *tally
+	counts := make(map[string]*tally)
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		it := l.t[t]
+		k := key(it)
+		c, ok := counts[k]
+		if !ok {
+			c = &tally{first: it, order: len(counts)}
+			counts[k] = c
+		}
+		c.n++
+		if best == nil || c.n > best.n || c.n == best.n && c.order < best.order {
+			best = c
+		}
+	}
+	if best == nil {
+		var zero T
+		return zero, 0, ErrNoValues
+	}
+	return best.first, best.n, nil
+}
+
+// entries in the from, to window partitioned by key of their item, each
+// group oldest first, in one pass. the groups are fresh copies owned by the
+// caller, and as a slice is kept per distinct key a high cardinality key
+// costs a slice header and its spare capacity per key on top of the
+// entries. ErrEmpty for an empty log, as Range.
+func (l *History[T]) GroupBy(from time.Time, to time.Time, key func(it T) string) (_ map[string][]Entry[T], err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	groups := make(map[string][]Entry[T])
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		e := l.entryAt(t)
+		k := key(e.Item)
+		groups[k] = append(groups[k], e)
+	}
+	return groups, nil
+}
+
+// smallest item in the from, to window and its time, the earliest
+// wins ties
+func (l *History[T]) MinBetween(from time.Time, to time.Time, less func(a T, b T) bool) (T, time.Time, error) {
+	return l.extremeBetween(from, to, less)
+}
+
+// largest item in the from, to window and its time, the earliest
+// wins ties
+func (l *History[T]) MaxBetween(from time.Time, to time.Time, less func(a T, b T) bool) (T, time.Time, error) {
+	return l.extremeBetween(from, to, func(a T, b T) bool { return less(b, a) })
+}
+
+// item for which no other in the window is better
+func (l *History[T]) extremeBetween(from time.Time, to time.Time, better func(a T, b T) bool) (T, time.Time, error) {
+	found := false
+	best, err := Fold(l, from, to, Entry[T]{}, func(best Entry[T], t time.Time, it T) Entry[T] {
+		if !found || better(it, best.Item) {
+			best, found = Entry[T]{Time: t, Item: it}, true
+		}
+		return best
+	})
+	if err == nil && !found {
+		err = ErrNoValues
+	}
+	return best.Item, best.Time, err
+}
+
+// item at percentile p in [0, 1] of the items in the from, to window,
+// by nearest rank: the items are sorted with less and the one at 1-based
+// rank ceil(p * n) returned, rank 1 for p = 0. equal items keep time order.
+func (l *History[T]) PercentileBetween(from time.Time, to time.Time, p float64, less func(a T, b T) bool) (_ T, err error) {
+	defer l.catch(&err)
+	var zero T
+	if !(p >= 0 && p <= 1) {
+		return zero, fmt.Errorf("%w: %v", ErrPercentile, p)
+	}
+
+	items := l.itemsBetween(nil, from, to)
+	if len(items) == 0 {
+		return zero, ErrNoValues
+	}
+
+	slices.SortStableFunc(items, compareWith(less))
+	return items[nearestRank(p, len(items))], nil
+}
+
+// PercentileBetween sorting the window's items in buf's memory rather than
+// a fresh slice, returning buf grown as needed for reuse on the next call
+func (l *History[T]) PercentileIntoBuf(buf []T, from time.Time, to time.Time, p float64, less func(a T, b T) bool) (_ T, _ []T, err error) {
+	defer l.catch(&err)
+	var zero T
+	if !(p >= 0 && p <= 1) {
+		return zero, buf, fmt.Errorf("%w: %v", ErrPercentile, p)
+	}
+
+	buf = l.itemsBetween(buf[:0], from, to)
+	if len(buf) == 0 {
+		return zero, buf, ErrNoValues
+	}
+
+	slices.SortStableFunc(buf, compareWith(less))
+	return buf[nearestRank(p, len(buf))], buf, nil
+}
+
+// 0-based index of the nearest rank for percentile p of n items
+func nearestRank(p float64, n int) int {
+	return max(int(math.Ceil(p*float64(n)))-1, 0)
+}
+
+// three way comparison from a less function
+func compareWith[T any](less func(a T, b T) bool) func(a T, b T) int {
+	return func(a T, b T) int {
+		if less(a, b) {
+			return -1
+		} else if less(b, a) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// the items in the from, to window appended to dst, a fresh copy for nil
+func (l *History[T]) itemsBetween(dst []T, from time.Time, to time.Time) []T {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	items := slices.Grow(dst, hi-lo)
+	for i := lo; i < hi; i++ {
+		items = append(items, l.t[l.times[i]])
+	}
+	return items
+}
+
+// counts of the items in the from, to window per bucket, numBuckets of
+// them. bucketIndex maps an item to its bucket, and indexes outside
+// [0, numBuckets) are clamped to the first or last bucket so that every item
+// is counted once. an empty window gives all zero counts.
+func (l *History[T]) HistogramBetween(from time.Time, to time.Time, bucketIndex func(it T) int, numBuckets int) (_ []int, err error) {
+	defer l.catch(&err)
+	if numBuckets <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrBuckets, numBuckets)
+	}
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	counts := make([]int, numBuckets)
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		counts[min(max(bucketIndex(l.t[l.times[i]]), 0), numBuckets-1)]++
+	}
+	return counts, nil
+}
+
+// average over [from, to] with each item weighted by how long it held:
+// from its time, or from if that is later, until the next item's time or to.
+// the item at or before from counts from from, and the newest item in the
+// window holds until to. as this weighs time rather than items the bounds
+// setting makes no difference. scale weights an item by its duration and div
+// divides the weighted sum by the total duration.
+func (l *History[T]) TimeWeightedAvgBetween(
+	from time.Time,
+	to time.Time,
+	scale func(it T, d time.Duration) T,
+	sum func(a T, b T) T,
+	div func(a T, d time.Duration) T,
+) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var cum T
+	var total time.Duration
+	for i := max(indexAfter(l.times, from)-1, 0); i < len(l.times) && l.times[i].Before(to); i++ {
+		start, end := l.times[i], to
+		if start.Before(from) {
+			start = from
+		}
+		if i+1 < len(l.times) && l.times[i+1].Before(to) {
+			end = l.times[i+1]
+		}
+		if d := end.Sub(start); d > 0 {
+			cum = sum(cum, scale(l.t[l.times[i]], d))
+			total += d
+		}
+	}
+
+	if total == 0 {
+		var zero T
+		return zero, ErrNoValues
+	}
+	return div(cum, total), nil
+}
+
+// area under valueOf of the items over [from, to] in value-seconds, by the
+// trapezoidal rule between consecutive items. a segment cut by from or to
+// counts up to the cut, with the value there interpolated linearly between
+// its two items. the area ends at the oldest and newest items rather than
+// being extrapolated, so a single item has none, and ErrNoValues is
+// returned if no segment between two items overlaps the window. as this
+// integrates over time the bounds setting makes no difference.
+func (l *History[T]) IntegrateBetween(from time.Time, to time.Time, valueOf func(it T) float64) (_ float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	area := 0.0
+	found := false
+	for i := max(indexAfter(l.times, from)-1, 0); i+1 < len(l.times) && l.times[i].Before(to); i++ {
+		a, b := l.times[i], l.times[i+1]
+		if !b.After(from) {
+			continue
+		}
+		va, vb := valueOf(l.t[a]), valueOf(l.t[b])
+		at := func(t time.Time) float64 {
+			return va + (vb-va)*float64(t.Sub(a))/float64(b.Sub(a))
+		}
+		start, end := a, b
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		area += (at(start) + at(end)) / 2 * end.Sub(start).Seconds()
+		found = true
+	}
+
+	if !found {
+		return 0, ErrNoValues
+	}
+	return area, nil
+}
+
+// averages of the items in consecutive buckets [start, start+interval)
+// from from until to, with the start time of each bucket. the outer ends
+// follow the bounds setting, so a Closed window puts an item at to in the
+// last bucket. empty buckets are skipped, or emitted with the zero value of
+// T if keepEmpty is set.
+func (l *History[T]) Bucket(
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	keepEmpty bool,
+) ([]time.Time, []T, error) {
+	return l.BucketCtx(context.Background(), from, to, interval, sum, div, keepEmpty)
+}
+
+// Bucket that gives up with ctx's error once ctx is done, checked at each
+// bucket and every ctxCheckEvery items, or with ErrLockTimeout as
+// AvgBetweenCtx
+func (l *History[T]) BucketCtx(
+	ctx context.Context,
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	keepEmpty bool,
+) (_ []time.Time, _ []T, err error) {
+	defer l.catch(&err)
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInterval, interval)
+	}
+
+	if err := l.rlockCtx(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer l.mux.RUnlock()
+
+	starts := make([]time.Time, 0)
+	avgs := make([]T, 0)
+	i, hi := l.window(from, to)
+	for start := from; start.Before(to); start = start.Add(interval) {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		end := hi
+		if next := start.Add(interval); next.Before(to) {
+			end = min(indexAtOrAfter(l.times, next), hi)
+		}
+
+		var cum T
+		count := 0
+		for ; i < end; i++ {
+			if count > 0 && count%ctxCheckEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, err
+				}
+			}
+			cum = sum(cum, l.t[l.times[i]])
+			count++
+		}
+
+		if count > 0 {
+			starts = append(starts, start)
+			avgs = append(avgs, div(cum, count))
+		} else if keepEmpty {
+			starts = append(starts, start)
+			avgs = append(avgs, cum)
+		}
+	}
+	return starts, avgs, nil
+}
+
+// number of items in each of the consecutive buckets [start, start+interval)
+// from from until to, with the start time of each bucket. unlike Bucket,
+// empty buckets are always emitted as 0 so the starts form a continuous
+// axis. the outer ends follow the bounds setting as in Bucket. the window
+// is found by binary search and walked once.
+func (l *History[T]) CountBuckets(from time.Time, to time.Time, interval time.Duration) ([]time.Time, []int, error) {
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInterval, interval)
+	}
+
+	starts := bucketStarts(from, to, interval)
+	n := len(starts)
+	counts := make([]int, n)
+	if n == 0 {
+		return starts, counts, nil
+	}
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		counts[min(int(t.Sub(from)/interval), n-1)]++
+	}
+	return starts, counts, nil
+}
+
+// start times of the buckets [start, start+interval) covering from until to
+func bucketStarts(from time.Time, to time.Time, interval time.Duration) []time.Time {
+	n := 0
+	if to.After(from) {
+		n = int((to.Sub(from) + interval - 1) / interval)
+	}
+	starts := make([]time.Time, n)
+	for k := range starts {
+		starts[k] = from.Add(time.Duration(k) * interval)
+	}
+	return starts
+}
+
+// items at each percentile in ps of the items in each bucket laid out as in
+// CountBuckets, by nearest rank as in PercentileBetween, with the start
+// time of each bucket. an empty bucket keeps its start, so the starts form
+// a continuous axis, and has a nil row. the window is copied under the lock
+// and sorted after it.
+func (l *History[T]) BucketPercentiles(
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	ps []float64,
+	less func(a T, b T) bool,
+) (_ []time.Time, _ [][]T, err error) {
+	defer l.catch(&err)
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInterval, interval)
+	}
+	for _, p := range ps {
+		if !(p >= 0 && p <= 1) {
+			return nil, nil, fmt.Errorf("%w: %v", ErrPercentile, p)
+		}
+	}
+
+	starts := bucketStarts(from, to, interval)
+	buckets := l.bucketItems(from, to, interval, len(starts))
+	rows := make([][]T, len(starts))
+	for k, items := range buckets {
+		if len(items) == 0 {
+			continue
+		}
+		slices.SortStableFunc(items, compareWith(less))
+		rows[k] = make([]T, len(ps))
+		for j, p := range ps {
+			rows[k][j] = items[nearestRank(p, len(items))]
+		}
+	}
+	return starts, rows, nil
+}
+
+// copies of the items in the from, to window split into n buckets of
+// interval from from
+func (l *History[T]) bucketItems(from time.Time, to time.Time, interval time.Duration, n int) [][]T {
+	buckets := make([][]T, n)
+	if n == 0 {
+		return buckets
+	}
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		k := min(int(t.Sub(from)/interval), n-1)
+		buckets[k] = append(buckets[k], l.t[t])
+	}
+	return buckets
+}
+
+// items interpolated by lerp at from + k*step for k = 0, 1, ... through the
+// from, to window, so under the default bounds the grid stops short of to.
+// grid points before the oldest or after the newest item are skipped
+// rather than extrapolated.
+func (l *History[T]) Resample(
+	from time.Time,
+	to time.Time,
+	step time.Duration,
+	lerp func(a T, b T, frac float64) T,
+) (_ []time.Time, _ []T, err error) {
+	defer l.catch(&err)
+	if step <= 0 {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInterval, step)
+	}
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, nil, ErrEmpty
+	}
+
+	oldest, newest := l.times[0], l.times[len(l.times)-1]
+	var points []time.Time
+	var items []T
+	t := from
+	if !l.bounds.includesFrom() {
+		t = t.Add(step)
+	}
+	for ; t.Before(to) || (l.bounds.includesTo() && t.Equal(to)); t = t.Add(step) {
+		if t.Before(oldest) || t.After(newest) {
+			continue
+		}
+		it, _ := l.interpolate(t, lerp)
+		points = append(points, t)
+		items = append(items, it)
+	}
+	return points, items, nil
+}
+
+// change per second from the first to the last item in the from, to
+// window. sub gives the change b - a, perSecond divides it by the elapsed
+// time. a single item, or several at one instant, has no rate.
+func (l *History[T]) Rate(
+	from time.Time,
+	to time.Time,
+	sub func(a T, b T) T,
+	perSecond func(delta T, d time.Duration) float64,
+) (_ float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if hi == lo {
+		return 0, ErrNoValues
+	}
+
+	first, last := l.times[lo], l.times[hi-1]
+	d := last.Sub(first)
+	if d <= 0 {
+		return 0, ErrTooFew
+	}
+	return perSecond(sub(l.t[first], l.t[last]), d), nil
+}
+
+// change from the item Before from to the item Before to, each the last
+// stored at or before its time, as sub(toItem, fromItem): the later item
+// comes first, so a counter's increase is sub returning a - b. ErrEmpty
+// for an empty log, and ErrBeforeStart naming the end when from or to
+// precedes the oldest item.
+func (l *History[T]) Delta(from time.Time, to time.Time, sub func(toItem T, fromItem T) T) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var zero T
+	a, _, err := l.before(from)
+	if err != nil {
+		return zero, fmt.Errorf("from: %w", err)
+	}
+	b, _, err := l.before(to)
+	if err != nil {
+		return zero, fmt.Errorf("to: %w", err)
+	}
+	return sub(b, a), nil
+}
+
+// change per second between each pair of consecutive items in the from,
+// to window, stamped at the later of the two, as parallel slices oldest
+// first. as in Rate, sub gives the change b - a and perSecond divides it by
+// the time between them. only pairs with both items in the window count, so
+// under the default bounds the item at to is left out and the first item at
+// or after from has no pair before it. a window of one item gives empty
+// slices. ErrEmpty for an empty log.
+func (l *History[T]) Derivative(
+	from time.Time,
+	to time.Time,
+	sub func(a T, b T) T,
+	perSecond func(delta T, d time.Duration) float64,
+) (times []time.Time, rates []float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, nil, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	if hi-lo < 2 {
+		return []time.Time{}, []float64{}, nil
+	}
+	times = make([]time.Time, 0, hi-lo-1)
+	rates = make([]float64, 0, hi-lo-1)
+	for i := lo + 1; i < hi; i++ {
+		prev, t := l.times[i-1], l.times[i]
+		times = append(times, t)
+		rates = append(rates, perSecond(sub(l.t[prev], l.t[t]), t.Sub(prev)))
+	}
+	return times, rates, nil
+}
+
+// AvgBetween for float histories with Neumaier's compensated summation, so
+// the error does not grow with the number of items as a naive sum's does
+// when magnitudes differ widely. items are summed as float64.
+func AvgBetweenStable[F ~float32 | ~float64](l *History[F], from time.Time, to time.Time) (F, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if lo == hi {
+		return 0, ErrNoValues
+	}
+
+	sum, c := 0.0, 0.0
+	for i := lo; i < hi; i++ {
+		x := float64(l.t[l.times[i]])
+		t := sum + x
+		if math.Abs(sum) >= math.Abs(x) {
+			c += (sum - t) + x
+		} else {
+			c += (x - t) + sum
+		}
+		sum = t
+	}
+	return F((sum + c) / float64(hi-lo)), nil
+}
+
+// up to k entries picked uniformly at random from the from, to window in
+// one pass by reservoir sampling, oldest first. the window being no bigger
+// than k, all of it is returned. rng makes the pick repeatable, nil uses
+// the global source.
+func (l *History[T]) Sample(from time.Time, to time.Time, k int, rng *rand.Rand) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	intn := rand.Intn
+	if rng != nil {
+		intn = rng.Intn
+	}
+
+	// reservoir of indexes, which sort back into time order
+	k = max(k, 0)
+	lo, hi := l.window(from, to)
+	picked := make([]int, 0, min(k, hi-lo))
+	for i := lo; i < hi; i++ {
+		if len(picked) < k {
+			picked = append(picked, i)
+		} else if j := intn(i - lo + 1); j < k {
+			picked[j] = i
+		}
+	}
+	slices.Sort(picked)
+
+	entries := make([]Entry[T], len(picked))
+	for n, i := range picked {
+		entries[n] = l.entryAt(l.times[i])
+	}
+	return entries, nil
+}
+
+// earliest item in the from, to window with valueOf above threshold, and
+// its time, walking forward and stopping at it. false if there is none.
+func (l *History[T]) FirstExceeding(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		if it := l.t[t]; valueOf(it) > threshold {
+			return it, t, true
+		}
+	}
+	var zero T
+	return zero, time.Time{}, false
+}
+
+// latest item in the from, to window with valueOf below threshold, and its
+// time, walking back from the newest. false if there is none.
+func (l *History[T]) LastBelow(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for i := hi - 1; i >= lo; i-- {
+		if it := l.t[l.times[i]]; valueOf(it) < threshold {
+			return it, l.times[i], true
+		}
+	}
+	var zero T
+	return zero, time.Time{}, false
+}
+
+// a time the value passed a threshold, see DirectedCrossings
+type Crossing struct {
+	Time   time.Time // time of the first sample past the threshold
+	Rising bool      // whether it went from at or below the threshold to above
+}
+
+// times in the from, to window at which valueOf of consecutive items
+// straddles threshold, see DirectedCrossings
+func (l *History[T]) Crossings(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) ([]time.Time, error) {
+	crossings, err := l.DirectedCrossings(from, to, threshold, valueOf)
+	times := make([]time.Time, len(crossings))
+	for i, c := range crossings {
+		times[i] = c.Time
+	}
+	return times, err
+}
+
+// crossings of threshold by valueOf of consecutive items in the from, to
+// window, oldest first. a value equal to threshold counts as below it, so
+// rising means going from at or below to above, falling the reverse, and a
+// signal that touches the threshold without passing it does not cross. each
+// crossing is timed by the first sample on its new side. NaN values are
+// skipped.
+func (l *History[T]) DirectedCrossings(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) (_ []Crossing, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	var crossings []Crossing
+	var above, seen bool
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		v := valueOf(l.t[l.times[i]])
+		if math.IsNaN(v) {
+			continue
+		}
+		if seen && v > threshold != above {
+			crossings = append(crossings, Crossing{Time: l.times[i], Rising: !above})
+		}
+		above, seen = v > threshold, true
+	}
+	return crossings, nil
+}
+
+// a stretch without items, see Gaps
+type Gap struct {
+	Start    time.Time     // time of the item before, or from for a leading gap
+	End      time.Time     // time of the item after, or to for a trailing gap
+	Duration time.Duration // End - Start
+}
+
+// stretches longer than minGap without an item in the from, to window,
+// oldest first: between consecutive items, from from to the first item and
+// from the last item to to, or all of from to to if the window is empty.
+// ErrEmpty for an empty log.
+func (l *History[T]) Gaps(from time.Time, to time.Time, minGap time.Duration) ([]Gap, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	var gaps []Gap
+	gap := func(start time.Time, end time.Time) {
+		if d := end.Sub(start); d > minGap {
+			gaps = append(gaps, Gap{Start: start, End: end, Duration: d})
+		}
+	}
+	prev := from
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		gap(prev, t)
+		prev = t
+	}
+	gap(prev, to)
+	return gaps, nil
+}
+
+// mean and population variance of valueOf of the items in the from, to
+// window with their number, found in one pass by Welford's algorithm so
+// that large values don't lose the variance to cancellation. ErrNoValues
+// for an empty window.
+func (l *History[T]) VarianceBetween(from time.Time, to time.Time, valueOf func(it T) float64) (mean float64, variance float64, n int, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var m2 float64
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		v := valueOf(l.t[t])
+		n++
+		d := v - mean
+		mean += d / float64(n)
+		m2 += d * (v - mean)
+	}
+	if n == 0 {
+		return 0, 0, 0, ErrNoValues
+	}
+	return mean, m2 / float64(n), n, nil
+}
+
+// average of valueOf of the items in the from, to window, each weighted by
+// exp(-ln2 * age / halfLife) for its age before to, so an item halfLife
+// older than another counts half as much. the weights are taken relative to
+// the newest item in the window rather than to, which cancels out of the
+// average and keeps them from all underflowing to 0 in a long window; items
+// far older than the newest still fall to a weight of 0. ErrNoValues for an
+// empty window, ErrInterval for a halfLife that is not positive.
+func (l *History[T]) EWMA(from time.Time, to time.Time, halfLife time.Duration, valueOf func(it T) float64) (_ float64, err error) {
+	defer l.catch(&err)
+	if halfLife <= 0 {
+		return 0, fmt.Errorf("%w: %v", ErrInterval, halfLife)
+	}
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if lo == hi {
+		return 0, ErrNoValues
+	}
+
+	newest := l.times[hi-1]
+	var sum, total float64
+	for _, t := range l.times[lo:hi] {
+		w := math.Exp(-math.Ln2 * float64(newest.Sub(t)) / float64(halfLife))
+		sum += w * valueOf(l.t[t])
+		total += w
+	}
+	return sum / total, nil
+}
+
+// Pearson correlation of a of the items in the from, to window of l with b
+// of the item of other at or before each of them, so the series need not
+// be sampled at the same times. items of l older than every item of other
+// have nothing to align with and are skipped. other is copied before l is
+// locked, as in Merge, so the two locks are never held together. ErrTooFew
+// with fewer than two aligned points, and NaN if either series is constant.
+func (l *History[T]) Correlate(other *History[T], from time.Time, to time.Time, a func(it T) float64, b func(it T) float64) (_ float64, err error) {
+	defer l.catch(&err)
+	times, values := other.valuesUntil(to, b)
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var n int
+	var meanX, meanY, mxx, myy, mxy float64
+	j := 0
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		for j < len(times) && !times[j].After(t) {
+			j++
+		}
+		if j == 0 {
+			continue
+		}
+		x, y := a(l.t[t]), values[j-1]
+		n++
+		dx, dy := x-meanX, y-meanY
+		meanX += dx / float64(n)
+		meanY += dy / float64(n)
+		mxx += dx * (x - meanX)
+		myy += dy * (y - meanY)
+		mxy += dx * (y - meanY)
+	}
+	if n < 2 {
+		return 0, fmt.Errorf("%w: %d aligned points", ErrTooFew, n)
+	}
+	if mxx == 0 || myy == 0 {
+		return math.NaN(), nil
+	}
+	return mxy / math.Sqrt(mxx*myy), nil
+}
+
+// times of the items stored at or before to, with valueOf of them
+func (l *History[T]) valuesUntil(to time.Time, valueOf func(it T) float64) ([]time.Time, []float64) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	times := slices.Clone(l.times[:indexAfter(l.times, to)])
+	values := make([]float64, len(times))
+	for i, t := range times {
+		values[i] = valueOf(l.t[t])
+	}
+	return times, values
+}
@@ -0,0 +1,730 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func makeSeconds(n int) (*History[int], time.Time) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < n; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	return lg, tm
+}
+
+func seconds(tm time.Time, n int) time.Time {
+	return tm.Add(time.Duration(n) * time.Second)
+}
+
+// Fold builds an aggregation with its own accumulator type
+func TestFold(t *testing.T) {
+	lg, tm := makeSeconds(10)
+
+	spans, err := Fold(lg, seconds(tm, 2), seconds(tm, 6), []string(nil), func(acc []string, then time.Time, it int) []string {
+		return append(acc, strconv.Itoa(it)+"@"+strconv.Itoa(int(then.Unix())))
+	})
+	if err != nil || !slices.Equal(spans, []string{"2@2", "3@3", "4@4", "5@5"}) {
+		t.Error("expected the window folded oldest first, got", spans, err)
+	}
+	if n, err := Fold(lg, seconds(tm, 20), seconds(tm, 30), 7, func(n int, _ time.Time, _ int) int { return n + 1 }); err != nil || n != 7 {
+		t.Error("expected an empty window to give acc back, got", n, err)
+	}
+}
+
+// SumBetween and CountBetween use the same window as AvgBetween
+func TestSumCountBetween(t *testing.T) {
+	lg, tm := makeSeconds(10)
+	sum := func(a int, b int) int { return a + b }
+
+	if s, err := lg.SumBetween(seconds(tm, 2), seconds(tm, 6), sum); err != nil || s != 2+3+4+5 {
+		t.Error("SumBetween got", s, "expected 14", err)
+	}
+	if s, err := lg.SumBetween(seconds(tm, 20), seconds(tm, 30), sum); err != nil || s != 0 {
+		t.Error("SumBetween on empty window got", s, err)
+	}
+	if n, err := lg.CountBetween(seconds(tm, 2), seconds(tm, 6)); err != nil || n != 4 {
+		t.Error("CountBetween got", n, "expected 4", err)
+	}
+}
+
+// MinBetween and MaxBetween find the extremes and their times
+func TestDistinctCountBetween(t *testing.T) {
+	lg, tm := makeSeconds(10)
+	mod3 := func(it int) string { return strconv.Itoa(it % 3) }
+
+	if n, err := lg.DistinctCountBetween(tm, seconds(tm, 10), mod3); err != nil || n != 3 {
+		t.Error("expected 3 keys, got", n, err)
+	}
+	// [3s, 4s) holds only 3
+	if n, _ := lg.DistinctCountBetween(seconds(tm, 3), seconds(tm, 4), mod3); n != 1 {
+		t.Error("expected 1 key, got", n)
+	}
+	if _, err := MakeHistory[int](time.Hour).DistinctCountBetween(tm, tm, mod3); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// ModeBetween counts keys, a tie going to the earliest seen
+func TestModeBetween(t *testing.T) {
+	lg := MakeHistory[string](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []string{"b", "a", "c", "a", "b", "c", "c"} {
+		lg.Add(seconds(tm, i), v)
+	}
+	id := func(v string) string { return v }
+
+	if it, n, err := lg.ModeBetween(tm, seconds(tm, 10), id); err != nil || it != "c" || n != 3 {
+		t.Error("expected c 3 times, got", it, n, err)
+	}
+	if it, n, err := lg.ModeBetween(tm, seconds(tm, 5), id); err != nil || it != "b" || n != 2 {
+		t.Error("expected the tie to go to b, got", it, n, err)
+	}
+	if _, _, err := lg.ModeBetween(seconds(tm, 20), seconds(tm, 30), id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// GroupBy splits the window by key, keeping time order in each group
+func TestGroupBy(t *testing.T) {
+	lg, tm := makeSeconds(10)
+	parity := func(it int) string { return strconv.Itoa(it % 2) }
+
+	groups, err := lg.GroupBy(seconds(tm, 1), seconds(tm, 6), parity)
+	if err != nil || len(groups) != 2 {
+		t.Fatal("expected two groups, got", groups, err)
+	}
+	for k, want := range map[string][]int{"0": {2, 4}, "1": {1, 3, 5}} {
+		var got []int
+		for _, e := range groups[k] {
+			got = append(got, e.Item)
+		}
+		if !slices.Equal(got, want) {
+			t.Error("group", k, "expected", want, "got", got)
+		}
+	}
+
+	if _, err := MakeHistory[int](time.Hour).GroupBy(tm, tm, parity); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// the big values cancel, leaving the ones a naive sum loses against them
+func TestAvgBetweenStable(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 300; i += 3 {
+		lg.Add(seconds(tm, i), 1e100)
+		lg.Add(seconds(tm, i+1), 1)
+		lg.Add(seconds(tm, i+2), -1e100)
+	}
+	want := 1.0 / 3
+
+	sum := func(a float64, b float64) float64 { return a + b }
+	div := func(a float64, n int) float64 { return a / float64(n) }
+	naive, _ := lg.AvgBetween(tm, seconds(tm, 300), sum, div)
+	if naive == want {
+		t.Fatal("expected the naive average to be off for this input")
+	}
+
+	stable, err := AvgBetweenStable(lg, tm, seconds(tm, 300))
+	if err != nil || stable != want {
+		t.Error("expected", want, "got", stable, err, "naive", naive)
+	}
+	if _, err := AvgBetweenStable(lg, seconds(tm, 400), seconds(tm, 500)); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+func TestMinMaxBetween(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{5, 2, 8, 2, 8, 1} {
+		lg.Add(seconds(tm, i), v)
+	}
+	less := func(a int, b int) bool { return a < b }
+
+	if v, ti, err := lg.MinBetween(tm.Add(-time.Second), seconds(tm, 5), less); err != nil || v != 2 || !ti.Equal(seconds(tm, 1)) {
+		t.Error("MinBetween got", v, ti, err)
+	}
+	if v, ti, err := lg.MaxBetween(tm.Add(-time.Second), seconds(tm, 5), less); err != nil || v != 8 || !ti.Equal(seconds(tm, 2)) {
+		t.Error("MaxBetween got", v, ti, err)
+	}
+	if _, _, err := lg.MinBetween(seconds(tm, 10), seconds(tm, 20), less); !errors.Is(err, ErrNoValues) {
+		t.Error("MinBetween on empty window:", err)
+	}
+}
+
+// PercentileBetween uses the nearest rank
+func TestWindowStats(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{4, 9, 1, 6, 5} {
+		lg.Add(seconds(tm, i), v)
+	}
+	sum := func(a int, b int) int { return a + b }
+	less := func(a int, b int) bool { return a < b }
+	div := func(a int, n int) int { return a / n }
+
+	st, err := lg.WindowStats(seconds(tm, 1), seconds(tm, 4), sum, less, div)
+	want := Stats[int]{
+		Count: 3, Sum: 16, Min: 1, Max: 9, Avg: 5,
+		First: Entry[int]{Time: seconds(tm, 1), Item: 9},
+		Last:  Entry[int]{Time: seconds(tm, 3), Item: 6},
+	}
+	if err != nil || st != want {
+		t.Error("expected", want, "got", st, err)
+	}
+
+	if _, err := lg.WindowStats(seconds(tm, 10), seconds(tm, 20), sum, less, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+func TestPercentileBetween(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{7, 3, 9, 1, 5, 10, 2, 8, 4, 6} {
+		lg.Add(seconds(tm, i), v)
+	}
+	less := func(a int, b int) bool { return a < b }
+	from, to := tm.Add(-time.Second), seconds(tm, 10)
+
+	cases := []struct {
+		p    float64
+		want int
+	}{
+		{0, 1},
+		{0.1, 1},
+		{0.11, 2},
+		{0.5, 5},
+		{0.95, 10},
+		{1, 10},
+	}
+	for _, c := range cases {
+		if v, err := lg.PercentileBetween(from, to, c.p, less); err != nil || v != c.want {
+			t.Error("p", c.p, "got", v, "expected", c.want, err)
+		}
+	}
+
+	if _, err := lg.PercentileBetween(from, to, 1.5, less); !errors.Is(err, ErrPercentile) {
+		t.Error("expected percentile error, got", err)
+	}
+	if _, err := lg.PercentileBetween(seconds(tm, 20), seconds(tm, 30), 0.5, less); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// PercentileIntoBuf answers as PercentileBetween in the caller's buffer
+func TestPercentileIntoBuf(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{7, 3, 9, 1, 5, 10, 2, 8, 4, 6} {
+		lg.Add(seconds(tm, i), v)
+	}
+	less := func(a int, b int) bool { return a < b }
+
+	buf := make([]int, 0, 4)
+	v, buf, err := lg.PercentileIntoBuf(buf, tm, seconds(tm, 10), 0.5, less)
+	if err != nil || v != 5 || len(buf) != 10 {
+		t.Error("expected the median with the buffer grown, got", v, buf, err)
+	}
+	grown := &buf[0]
+	v, buf, err = lg.PercentileIntoBuf(buf, tm, seconds(tm, 4), 1, less)
+	if err != nil || v != 9 || &buf[0] != grown {
+		t.Error("expected the buffer reused, got", v, buf, err)
+	}
+}
+
+func BenchmarkPercentileBetween(b *testing.B) {
+	lg, from, to := benchHistory()
+	less := func(a int, b int) bool { return a < b }
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.PercentileBetween(from, to, 0.9, less)
+	}
+}
+
+func BenchmarkPercentileIntoBuf(b *testing.B) {
+	lg, from, to := benchHistory()
+	less := func(a int, b int) bool { return a < b }
+	var buf []int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, buf, _ = lg.PercentileIntoBuf(buf, from, to, 0.9, less)
+	}
+}
+
+// TimeWeightedAvgBetween weights items by how long they held
+func TestHistogramBetween(t *testing.T) {
+	lg, tm := makeSeconds(10)
+
+	// buckets of width 3 with anything past 5 clamped into the last
+	counts, err := lg.HistogramBetween(tm, seconds(tm, 10), func(it int) int { return it / 3 }, 2)
+	if err != nil || !slices.Equal(counts, []int{3, 7}) {
+		t.Error("expected [3 7], got", counts, err)
+	}
+
+	counts, _ = lg.HistogramBetween(tm, seconds(tm, 4), func(it int) int { return it - 2 }, 3)
+	if !slices.Equal(counts, []int{3, 1, 0}) {
+		t.Error("expected negative indexes in the first bucket, got", counts)
+	}
+
+	if _, err := lg.HistogramBetween(tm, seconds(tm, 10), func(it int) int { return 0 }, 0); !errors.Is(err, ErrBuckets) {
+		t.Error("expected buckets error, got", err)
+	}
+}
+
+func TestTimeWeightedAvgBetween(t *testing.T) {
+	lg := MakeHistory[float64](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 10)
+	lg.Add(seconds(tm, 1), 20)
+	lg.Add(seconds(tm, 10), 30)
+
+	scale := func(it float64, d time.Duration) float64 { return it * d.Seconds() }
+	sum := func(a float64, b float64) float64 { return a + b }
+	div := func(a float64, d time.Duration) float64 { return a / d.Seconds() }
+
+	// 10 for 1s, 20 for 9s
+	if v, err := lg.TimeWeightedAvgBetween(tm, seconds(tm, 10), scale, sum, div); err != nil || v != 19 {
+		t.Error("got", v, "expected 19", err)
+	}
+	// 20 held from the earlier item for 4s, then 30 for 5s until to
+	if v, err := lg.TimeWeightedAvgBetween(seconds(tm, 6), seconds(tm, 15), scale, sum, div); err != nil || v != (20*4+30*5)/9.0 {
+		t.Error("got", v, "expected", (20*4+30*5)/9.0, err)
+	}
+	if _, err := lg.TimeWeightedAvgBetween(tm.Add(-time.Minute), tm, scale, sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// Bucket averages fixed intervals and optionally keeps empty ones
+func TestBucket(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for _, i := range []int{0, 1, 2, 3, 7, 8} {
+		lg.Add(seconds(tm, i), i)
+	}
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	starts, avgs, err := lg.Bucket(tm, seconds(tm, 9), time.Duration(3)*time.Second, sum, div, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(avgs) != 3 || avgs[0] != 1 || avgs[1] != 3 || avgs[2] != 7 || !starts[2].Equal(seconds(tm, 6)) {
+		t.Error("Bucket got", starts, avgs)
+	}
+
+	starts, avgs, _ = lg.Bucket(tm, seconds(tm, 12), time.Duration(2)*time.Second, sum, div, true)
+	want := []int{0, 2, 0, 7, 8, 0}
+	if !slices.Equal(avgs, want) || len(starts) != len(want) || !starts[5].Equal(seconds(tm, 10)) {
+		t.Error("Bucket with empty got", starts, avgs, "expected", want)
+	}
+
+	if _, _, err := lg.Bucket(tm, seconds(tm, 9), 0, sum, div, false); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+// Rate divides the change by the elapsed time
+func TestResample(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(seconds(tm, 2), 0)
+	lg.Add(seconds(tm, 4), 10)
+	lg.Add(seconds(tm, 8), 30)
+	lerp := func(a float64, b float64, frac float64) float64 { return a + (b-a)*frac }
+
+	// 0s and 1s precede the first item and 9s follows the last
+	points, items, err := lg.Resample(tm, seconds(tm, 10), time.Second, lerp)
+	if err != nil || len(points) != 7 || !points[0].Equal(seconds(tm, 2)) {
+		t.Fatal("unexpected grid", points, err)
+	}
+	if !slices.Equal(items, []float64{0, 5, 10, 15, 20, 25, 30}) {
+		t.Error("unexpected items", items)
+	}
+
+	if _, _, err := lg.Resample(tm, seconds(tm, 10), 0, lerp); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+func TestCountBuckets(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for _, at := range []int{0, 1, 2, 7, 8, 10} {
+		lg.Add(seconds(tm, at), at)
+	}
+
+	starts, counts, err := lg.CountBuckets(tm, seconds(tm, 10), time.Duration(3)*time.Second)
+	if err != nil || !slices.Equal(counts, []int{3, 0, 2, 0}) {
+		t.Error("expected [3 0 2 0], got", counts, err)
+	}
+	if len(starts) != 4 || !starts[3].Equal(seconds(tm, 9)) {
+		t.Error("unexpected starts", starts)
+	}
+
+	closed := MakeHistory[int](time.Hour, WithBounds(Closed))
+	closed.Add(seconds(tm, 3), 0)
+	closed.Add(seconds(tm, 6), 0)
+	if _, counts, _ := closed.CountBuckets(tm, seconds(tm, 6), time.Duration(3)*time.Second); !slices.Equal(counts, []int{0, 2}) {
+		t.Error("expected an item at to in the last bucket, got", counts)
+	}
+
+	if _, _, err := lg.CountBuckets(tm, seconds(tm, 10), 0); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+// each bucket gets its own percentiles, an empty one a nil row
+func TestBucketPercentiles(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for at, v := range map[int]int{0: 5, 1: 1, 2: 3, 7: 9, 8: 4} {
+		lg.Add(seconds(tm, at), v)
+	}
+	less := func(a int, b int) bool { return a < b }
+
+	starts, rows, err := lg.BucketPercentiles(tm, seconds(tm, 9), 3*time.Second, []float64{0, 0.5, 1}, less)
+	if err != nil || len(starts) != 3 || len(rows) != 3 {
+		t.Fatal("BucketPercentiles got", starts, rows, err)
+	}
+	if !slices.Equal(rows[0], []int{1, 3, 5}) || rows[1] != nil || !slices.Equal(rows[2], []int{4, 4, 9}) {
+		t.Error("unexpected rows", rows)
+	}
+
+	if _, _, err := lg.BucketPercentiles(tm, seconds(tm, 9), 3*time.Second, []float64{1.5}, less); !errors.Is(err, ErrPercentile) {
+		t.Error("expected percentile error, got", err)
+	}
+	if _, _, err := lg.BucketPercentiles(tm, seconds(tm, 9), 0, nil, less); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(seconds(tm, 2*i), 100+6*i)
+	}
+	sub := func(a int, b int) int { return b - a }
+	perSecond := func(delta int, d time.Duration) float64 { return float64(delta) / d.Seconds() }
+
+	if r, err := lg.Rate(tm.Add(-time.Second), seconds(tm, 9), sub, perSecond); err != nil || r != 3 {
+		t.Error("Rate got", r, "expected 3", err)
+	}
+	if _, err := lg.Rate(seconds(tm, 1), seconds(tm, 3), sub, perSecond); !errors.Is(err, ErrTooFew) {
+		t.Error("expected too few error, got", err)
+	}
+	if _, err := lg.Rate(seconds(tm, 20), seconds(tm, 30), sub, perSecond); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// Derivative gives the rate between each pair, at the later time
+func TestDerivative(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{0, 2, 2, 8} {
+		lg.Add(seconds(tm, 2*i), v)
+	}
+	sub := func(a float64, b float64) float64 { return b - a }
+	perSecond := func(d float64, dt time.Duration) float64 { return d / dt.Seconds() }
+
+	times, rates, err := lg.Derivative(tm, seconds(tm, 10), sub, perSecond)
+	if err != nil || !slices.Equal(rates, []float64{1, 0, 3}) || !times[0].Equal(seconds(tm, 2)) {
+		t.Error("expected rates 1, 0, 3 from 2s, got", times, rates, err)
+	}
+	if times, rates, err := lg.Derivative(tm, seconds(tm, 1), sub, perSecond); err != nil || len(times) != 0 || len(rates) != 0 {
+		t.Error("expected a single item to give nothing, got", times, rates, err)
+	}
+	if _, _, err := MakeHistory[float64](time.Hour).Derivative(tm, tm, sub, perSecond); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// a cancelled context stops the scan with its error
+func TestDelta(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{10, 13, 20, 26} {
+		lg.Add(seconds(tm, 2*i), v)
+	}
+	sub := func(toItem int, fromItem int) int { return toItem - fromItem }
+
+	// 10 at 0s to 20 at 4s, each end taking the last item at or before it
+	if d, err := lg.Delta(seconds(tm, 1), seconds(tm, 5), sub); err != nil || d != 10 {
+		t.Error("expected 10, got", d, err)
+	}
+	if d, err := lg.Delta(seconds(tm, 6), seconds(tm, 2), sub); err != nil || d != -13 {
+		t.Error("expected -13, got", d, err)
+	}
+	if _, err := lg.Delta(seconds(tm, -1), seconds(tm, 5), sub); !errors.Is(err, ErrBeforeStart) {
+		t.Error("expected before start error, got", err)
+	}
+	if _, err := MakeHistory[int](time.Hour).Delta(tm, tm, sub); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+func TestCtxCancelled(t *testing.T) {
+	lg, tm := makeSeconds(10)
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if v, err := lg.AvgBetweenCtx(ctx, tm.Add(-time.Second), seconds(tm, 10), sum, div); err != nil || v != 4 {
+		t.Error("AvgBetweenCtx got", v, err)
+	}
+
+	cancel()
+	if _, err := lg.AvgBetweenCtx(ctx, tm.Add(-time.Second), seconds(tm, 10), sum, div); !errors.Is(err, context.Canceled) {
+		t.Error("expected cancellation, got", err)
+	}
+	if _, _, err := lg.BucketCtx(ctx, tm, seconds(tm, 10), time.Second, sum, div, false); !errors.Is(err, context.Canceled) {
+		t.Error("expected cancellation, got", err)
+	}
+
+	// the lock was released
+	if _, err := lg.Add(seconds(tm, 10), 10); err != nil {
+		t.Error(err)
+	}
+}
+
+// the bounds setting applies to the ends of the whole bucketed window
+func TestBucketBounds(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1)*time.Hour, WithBounds(OpenClosed))
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(seconds(tm, i), i)
+	}
+	sum := func(a int, b int) int { return a + b }
+
+	_, sums, err := lg.Bucket(tm, seconds(tm, 4), time.Duration(2)*time.Second, sum, func(a int, n int) int { return a }, true)
+	if err != nil || !slices.Equal(sums, []int{1, 2 + 3 + 4}) {
+		t.Error("Bucket got", sums, "expected [1 9]", err)
+	}
+}
+
+// every entry is about as likely to be sampled, and samples come oldest first
+func TestSample(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	counts := make([]int, 10)
+	for n := 0; n < 2000; n++ {
+		entries, err := lg.Sample(tm, tm.Add(time.Minute), 3, rng)
+		if err != nil || len(entries) != 3 {
+			t.Fatal("Sample got", entries, err)
+		}
+		for i, e := range entries {
+			if i > 0 && !e.Time.After(entries[i-1].Time) {
+				t.Fatal("expected samples oldest first, got", entries)
+			}
+			counts[e.Item]++
+		}
+	}
+	for i, c := range counts {
+		if c < 450 || c > 750 {
+			t.Error("expected about 600 picks of", i, "got", c)
+		}
+	}
+
+	if entries, _ := lg.Sample(tm, tm.Add(5*time.Second), 10, rng); len(entries) != 5 {
+		t.Error("expected the whole small window, got", entries)
+	}
+	if _, err := MakeHistory[int](time.Hour).Sample(tm, tm, 1, nil); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// FirstExceeding and LastBelow find the ends of a level being passed
+func TestFirstExceedingLastBelow(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{50, 95, 80, 99, 40, 92} {
+		lg.Add(seconds(tm, i), v)
+	}
+	id := func(v float64) float64 { return v }
+
+	if v, at, ok := lg.FirstExceeding(tm, seconds(tm, 10), 90, id); !ok || v != 95 || !at.Equal(seconds(tm, 1)) {
+		t.Error("expected 95 at 1s, got", v, at, ok)
+	}
+	if v, at, ok := lg.LastBelow(tm, seconds(tm, 10), 90, id); !ok || v != 40 || !at.Equal(seconds(tm, 4)) {
+		t.Error("expected 40 at 4s, got", v, at, ok)
+	}
+	if _, _, ok := lg.FirstExceeding(tm, seconds(tm, 10), 99, id); ok {
+		t.Error("expected nothing above 99")
+	}
+	if _, _, ok := lg.LastBelow(seconds(tm, 5), seconds(tm, 10), 90, id); ok {
+		t.Error("expected nothing below 90 in the last second")
+	}
+}
+
+// a value at the threshold counts as below it
+func TestCrossings(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{1, 5, 5, 3, 3, 2, math.NaN(), 7, 3} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	id := func(v float64) float64 { return v }
+
+	crossings, err := lg.DirectedCrossings(tm, tm.Add(time.Minute), 3, id)
+	want := []Crossing{
+		{Time: tm.Add(time.Second), Rising: true},
+		{Time: tm.Add(3 * time.Second), Rising: false},
+		{Time: tm.Add(7 * time.Second), Rising: true},
+		{Time: tm.Add(8 * time.Second), Rising: false},
+	}
+	if err != nil || !slices.Equal(crossings, want) {
+		t.Error("DirectedCrossings got", crossings, err)
+	}
+
+	times, err := lg.Crossings(tm.Add(2*time.Second), tm.Add(7*time.Second), 3, id)
+	if err != nil || len(times) != 1 || !times[0].Equal(tm.Add(3*time.Second)) {
+		t.Error("Crossings got", times, err)
+	}
+	if times, _ := lg.Crossings(tm, tm.Add(time.Minute), 5, id); len(times) != 2 {
+		t.Error("expected touching 5 not to cross, got", times)
+	}
+}
+
+// gaps between items, and at the ends of the window, longer than minGap
+func TestGaps(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for _, at := range []int{5, 6, 7, 20, 21} {
+		lg.Add(seconds(tm, at), at)
+	}
+
+	gaps, err := lg.Gaps(tm, seconds(tm, 30), 4*time.Second)
+	want := []Gap{
+		{Start: tm, End: seconds(tm, 5), Duration: 5 * time.Second},
+		{Start: seconds(tm, 7), End: seconds(tm, 20), Duration: 13 * time.Second},
+		{Start: seconds(tm, 21), End: seconds(tm, 30), Duration: 9 * time.Second},
+	}
+	if err != nil || !slices.Equal(gaps, want) {
+		t.Error("Gaps got", gaps, err)
+	}
+
+	if gaps, _ := lg.Gaps(seconds(tm, 5), seconds(tm, 8), time.Second); gaps != nil {
+		t.Error("expected no gaps, got", gaps)
+	}
+	if gaps, _ := lg.Gaps(seconds(tm, 8), seconds(tm, 19), time.Second); len(gaps) != 1 || gaps[0].Duration != 11*time.Second {
+		t.Error("expected the empty window as one gap, got", gaps)
+	}
+	if _, err := MakeHistory[int](time.Hour).Gaps(tm, tm, 0); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// Welford's mean and variance hold up on values with a large offset
+func TestVarianceBetween(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		lg.Add(seconds(tm, i), 1e9+v)
+	}
+	id := func(v float64) float64 { return v }
+
+	mean, variance, n, err := lg.VarianceBetween(tm, seconds(tm, 60), id)
+	if err != nil || n != 8 || mean != 1e9+5 || math.Abs(variance-4) > 1e-6 {
+		t.Error("VarianceBetween got", mean, variance, n, err)
+	}
+	if _, _, _, err := lg.VarianceBetween(seconds(tm, 60), seconds(tm, 61), id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values, got", err)
+	}
+}
+
+// an item a half-life older weighs half as much
+func TestEWMA(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.Add(seconds(tm, 10), 3)
+	id := func(v float64) float64 { return v }
+
+	if avg, err := lg.EWMA(tm, seconds(tm, 60), 10*time.Second, id); err != nil || math.Abs(avg-2) > 1e-9 {
+		t.Error("expected (0.5*0 + 1*3) / 1.5, got", avg, err)
+	}
+
+	long := MakeHistory[float64](0)
+	for i := 0; i < 100; i++ {
+		long.Add(tm.Add(time.Duration(i)*time.Hour), 1)
+	}
+	if avg, err := long.EWMA(tm, tm.Add(1000*time.Hour), time.Second, id); err != nil || avg != 1 {
+		t.Error("expected a long window not to underflow, got", avg, err)
+	}
+
+	if _, err := lg.EWMA(seconds(tm, 60), seconds(tm, 61), time.Second, id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values, got", err)
+	}
+	if _, err := lg.EWMA(tm, seconds(tm, 60), 0, id); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+// the trapezoidal area is cut at from and to by interpolation
+func TestIntegrateBetween(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.Add(seconds(tm, 10), 10)
+	lg.Add(seconds(tm, 20), 10)
+	id := func(v float64) float64 { return v }
+
+	if area, err := lg.IntegrateBetween(tm, seconds(tm, 20), id); err != nil || area != 150 {
+		t.Error("expected 50 + 100, got", area, err)
+	}
+	if area, err := lg.IntegrateBetween(seconds(tm, 5), seconds(tm, 15), id); err != nil || area != 87.5 {
+		t.Error("expected 37.5 + 50, got", area, err)
+	}
+	if area, err := lg.IntegrateBetween(seconds(tm, -10), seconds(tm, 60), id); err != nil || area != 150 {
+		t.Error("expected no extrapolation, got", area, err)
+	}
+	if _, err := lg.IntegrateBetween(seconds(tm, 30), seconds(tm, 60), id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values past the newest item, got", err)
+	}
+
+	single := MakeHistory[float64](time.Hour)
+	single.Add(tm, 5)
+	if _, err := single.IntegrateBetween(seconds(tm, -10), seconds(tm, 10), id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected a single item to have no area, got", err)
+	}
+}
+
+// Correlate aligns other to l by the item at or before each of l's
+func TestCorrelate(t *testing.T) {
+	x := MakeHistory[float64](time.Hour)
+	y := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{1, 2, 3, 4, 5} {
+		x.Add(seconds(tm, 2*i+1), v)
+		y.Add(seconds(tm, 2*i), 10-2*v)
+	}
+	id := func(v float64) float64 { return v }
+
+	if r, err := x.Correlate(y, tm, seconds(tm, 20), id, id); err != nil || math.Abs(r+1) > 1e-9 {
+		t.Error("expected perfect anticorrelation, got", r, err)
+	}
+	if r, err := x.Correlate(x, tm, seconds(tm, 20), id, func(v float64) float64 { return 3*v + 1 }); err != nil || math.Abs(r-1) > 1e-9 {
+		t.Error("expected perfect correlation with itself, got", r, err)
+	}
+	if _, err := y.Correlate(x, tm, seconds(tm, 2), id, id); !errors.Is(err, ErrTooFew) {
+		t.Error("expected too few aligned points, got", err)
+	}
+}
@@ -0,0 +1,136 @@
+package history
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// item that sums with another of its type, for the Auto aggregates
+type Adder[T any] interface {
+	Add(other T) T
+}
+
+// item that divides by a count, for AvgBetweenAuto
+type Divider[T any] interface {
+	Div(n int) T
+}
+
+// item ordered against another of its type, for MinBetweenAuto and
+// MaxBetweenAuto
+type Comparer[T any] interface {
+	Less(other T) bool
+}
+
+// callbacks for an item type, registered with Register for the Auto
+// aggregates. a nil field leaves that aggregate to T's own method. sums
+// start from the zero value of T.
+type Ops[T any] struct {
+	Sum  func(a T, b T) T    // for SumBetweenAuto and AvgBetweenAuto
+	Div  func(a T, n int) T  // for AvgBetweenAuto
+	Less func(a T, b T) bool // for MinBetweenAuto and MaxBetweenAuto
+}
+
+// Ops by item type
+var registry sync.Map
+
+// makes the Auto aggregates of every History[T] use ops, so that a type
+// used in many places, or one whose methods can't be added such as float64,
+// needs its callbacks given only once. registered ops win over T's Add, Div
+// and Less. the registry is safe for concurrent use, and registering T
+// again replaces its ops for calls from then on, though it is meant to be
+// done once at init. an aggregate whose callback is neither registered nor
+// a method of T fails with ErrNotAggregatable.
+func Register[T any](ops Ops[T]) {
+	registry.Store(reflect.TypeFor[T](), ops)
+}
+
+// ops registered for T, the zero Ops if none
+func registered[T any]() Ops[T] {
+	ops, _ := registry.Load(reflect.TypeFor[T]())
+	o, _ := ops.(Ops[T])
+	return o
+}
+
+// sum callback as registered or calling T's Add, ErrNotAggregatable if T
+// has neither
+func adder[T any]() (func(a T, b T) T, error) {
+	if sum := registered[T]().Sum; sum != nil {
+		return sum, nil
+	}
+	var zero T
+	if _, ok := any(zero).(Adder[T]); !ok {
+		return nil, fmt.Errorf("%w: %T has no Add and no registered Sum", ErrNotAggregatable, zero)
+	}
+	return func(a T, b T) T { return any(a).(Adder[T]).Add(b) }, nil
+}
+
+// div callback as registered or calling T's Div
+func divider[T any]() (func(a T, n int) T, error) {
+	if div := registered[T]().Div; div != nil {
+		return div, nil
+	}
+	var zero T
+	if _, ok := any(zero).(Divider[T]); !ok {
+		return nil, fmt.Errorf("%w: %T has no Div and no registered Div", ErrNotAggregatable, zero)
+	}
+	return func(a T, n int) T { return any(a).(Divider[T]).Div(n) }, nil
+}
+
+// less callback as registered or calling T's Less
+func comparer[T any]() (func(a T, b T) bool, error) {
+	if less := registered[T]().Less; less != nil {
+		return less, nil
+	}
+	var zero T
+	if _, ok := any(zero).(Comparer[T]); !ok {
+		return nil, fmt.Errorf("%w: %T has no Less and no registered Less", ErrNotAggregatable, zero)
+	}
+	return func(a T, b T) bool { return any(a).(Comparer[T]).Less(b) }, nil
+}
+
+// SumBetween summing with the registered Sum or T's Add
+func (l *History[T]) SumBetweenAuto(from time.Time, to time.Time) (T, error) {
+	sum, err := adder[T]()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return l.SumBetween(from, to, sum)
+}
+
+// AvgBetween summing and dividing with the registered Sum and Div or T's
+// Add and Div
+func (l *History[T]) AvgBetweenAuto(from time.Time, to time.Time) (T, error) {
+	var zero T
+	sum, err := adder[T]()
+	if err != nil {
+		return zero, err
+	}
+	div, err := divider[T]()
+	if err != nil {
+		return zero, err
+	}
+	return l.AvgBetween(from, to, sum, div)
+}
+
+// MinBetween ordering with the registered Less or T's
+func (l *History[T]) MinBetweenAuto(from time.Time, to time.Time) (T, time.Time, error) {
+	less, err := comparer[T]()
+	if err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+	return l.MinBetween(from, to, less)
+}
+
+// MaxBetween ordering with the registered Less or T's
+func (l *History[T]) MaxBetweenAuto(from time.Time, to time.Time) (T, time.Time, error) {
+	less, err := comparer[T]()
+	if err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+	return l.MaxBetween(from, to, less)
+}
@@ -0,0 +1,105 @@
+package history
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// reading in watts, aggregated through its own methods
+type watts float64
+
+func (w watts) Add(other watts) watts { return w + other }
+func (w watts) Div(n int) watts       { return w / watts(n) }
+func (w watts) Less(other watts) bool { return w < other }
+
+func ExampleHistory_AvgBetweenAuto() {
+	lg := MakeHistory[watts](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, w := range []watts{100, 300, 200} {
+		lg.Add(tm.Add(time.Duration(i)*time.Minute), w)
+	}
+
+	avg, _ := lg.AvgBetweenAuto(tm, tm.Add(time.Hour))
+	peak, at, _ := lg.MaxBetweenAuto(tm, tm.Add(time.Hour))
+	fmt.Println(avg, peak, at.Sub(tm))
+	// Output: 200 300 1m0s
+}
+
+func TestAutoAggregates(t *testing.T) {
+	lg := MakeHistory[watts](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, w := range []watts{100, 300, 200} {
+		lg.Add(tm.Add(time.Duration(i)*time.Minute), w)
+	}
+
+	if sum, err := lg.SumBetweenAuto(tm, tm.Add(time.Hour)); err != nil || sum != 600 {
+		t.Error("SumBetweenAuto got", sum, err)
+	}
+	if low, at, err := lg.MinBetweenAuto(tm, tm.Add(time.Hour)); err != nil || low != 100 || !at.Equal(tm) {
+		t.Error("MinBetweenAuto got", low, at, err)
+	}
+	if _, err := lg.AvgBetweenAuto(tm.Add(time.Hour), tm.Add(2*time.Hour)); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values, got", err)
+	}
+}
+
+// without the methods the Auto aggregates fail instead of panicking
+func TestAutoNotAggregatable(t *testing.T) {
+	lg := MakeHistory[string](time.Hour)
+	lg.Add(time.Unix(0, 0), "a")
+
+	if _, err := lg.AvgBetweenAuto(time.Unix(0, 0), time.Unix(60, 0)); !errors.Is(err, ErrNotAggregatable) {
+		t.Error("expected not aggregatable, got", err)
+	}
+	if _, _, err := lg.MinBetweenAuto(time.Unix(0, 0), time.Unix(60, 0)); !errors.Is(err, ErrNotAggregatable) {
+		t.Error("expected not aggregatable, got", err)
+	}
+}
+
+// a reading in milliseconds, aggregated through registered ops
+type millis int64
+
+func ExampleRegister() {
+	Register(Ops[millis]{
+		Sum:  func(a millis, b millis) millis { return a + b },
+		Div:  func(a millis, n int) millis { return a / millis(n) },
+		Less: func(a millis, b millis) bool { return a < b },
+	})
+
+	lg := MakeHistory[millis](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, ms := range []millis{30, 90, 60} {
+		lg.Add(tm.Add(time.Duration(i)*time.Minute), ms)
+	}
+
+	avg, _ := lg.AvgBetweenAuto(tm, tm.Add(time.Hour))
+	low, _, _ := lg.MinBetweenAuto(tm, tm.Add(time.Hour))
+	fmt.Println(avg, low)
+	// Output: 60 30
+}
+
+// ordered by its own method, summed through registered ops
+type tally int
+
+func (n tally) Less(other tally) bool { return n < other }
+
+// registered ops fill in the methods T lacks
+func TestRegister(t *testing.T) {
+	Register(Ops[tally]{Sum: func(a tally, b tally) tally { return a + b }})
+	lg := MakeHistory[tally](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Minute), 2)
+
+	if sum, err := lg.SumBetweenAuto(tm, tm.Add(time.Hour)); err != nil || sum != 3 {
+		t.Error("expected the registered Sum, got", sum, err)
+	}
+	if high, _, err := lg.MaxBetweenAuto(tm, tm.Add(time.Hour)); err != nil || high != 2 {
+		t.Error("expected T's own Less, got", high, err)
+	}
+	if _, err := lg.AvgBetweenAuto(tm, tm.Add(time.Hour)); !errors.Is(err, ErrNotAggregatable) {
+		t.Error("expected no Div, got", err)
+	}
+}
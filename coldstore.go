@@ -0,0 +1,62 @@
+package history
+
+import (
+	"time"
+)
+
+// archive for evicted entries, set with ArchiveTo
+type ColdStore[T any] interface {
+	// takes the entries one eviction pass removed, called after the
+	// History's lock is released. entries from a TTL may be out of time
+	// order, and calls from concurrent Adds may interleave.
+	Put(entries []Entry[T])
+}
+
+// a ColdStore that can be read back, for RangeAll
+type ColdRanger[T any] interface {
+	ColdStore[T]
+	Range(from time.Time, to time.Time) ([]Entry[T], error) // archived entries in [from, to), oldest first
+}
+
+// hand each batch of evicted entries to cs rather than dropping them, so
+// they can be archived while the History stays bounded. cs is called once
+// per eviction pass, before OnEvict's fn. nil goes back to dropping them.
+func (l *History[T]) ArchiveTo(cs ColdStore[T]) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.cold = cs
+}
+
+// Range falling through to the cold store for the part of the window older
+// than the oldest item held, when the store set with ArchiveTo is a
+// ColdRanger. the archived entries come first, then the held ones. entries
+// evicted but not yet handed to the store by a concurrent Add can be missed.
+// without a ColdRanger it is the same as Range.
+func (l *History[T]) RangeAll(from time.Time, to time.Time) ([]Entry[T], error) {
+	l.rlock()
+	cold, _ := l.cold.(ColdRanger[T])
+	empty := len(l.times) == 0
+	end := to
+	if !empty && l.times[0].Before(to) {
+		end = l.times[0]
+	}
+	lo, hi := l.window(from, to)
+	hot := l.entriesIn(lo, hi)
+	l.mux.RUnlock()
+
+	if cold == nil {
+		if empty {
+			return nil, ErrEmpty
+		}
+		return hot, nil
+	}
+	if !from.Before(end) {
+		return hot, nil
+	}
+	archived, err := cold.Range(from, end)
+	if err != nil {
+		return hot, err
+	}
+	return append(archived, hot...), nil
+}
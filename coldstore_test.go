@@ -0,0 +1,58 @@
+package history
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// keeps everything it is given, read back in time order
+type memoryStore struct {
+	entries []Entry[int]
+	puts    int
+}
+
+func (s *memoryStore) Put(entries []Entry[int]) {
+	s.entries = append(s.entries, entries...)
+	s.puts++
+}
+
+func (s *memoryStore) Range(from time.Time, to time.Time) ([]Entry[int], error) {
+	var got []Entry[int]
+	for _, e := range s.entries {
+		if !e.Time.Before(from) && e.Time.Before(to) {
+			got = append(got, e)
+		}
+	}
+	return got, nil
+}
+
+// evicted entries go to the cold store in batches and RangeAll reads them
+func TestArchiveTo(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](5)
+	store := &memoryStore{}
+	lg.ArchiveTo(store)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 8; i++ {
+		lg.Add(seconds(tm, i), i)
+	}
+	lg.AddBatch([]Entry[int]{{Time: seconds(tm, 8), Item: 8}, {Time: seconds(tm, 9), Item: 9}})
+	if len(store.entries) != 5 || store.puts != 4 {
+		t.Error("expected 5 evicted in 4 batches, got", store.entries, store.puts)
+	}
+
+	all, err := lg.RangeAll(seconds(tm, 2), seconds(tm, 7))
+	var items []int
+	for _, e := range all {
+		items = append(items, e.Item)
+	}
+	if err != nil || !slices.Equal(items, []int{2, 3, 4, 5, 6}) {
+		t.Error("expected archived then held items, got", items, err)
+	}
+
+	lg.ArchiveTo(nil)
+	lg.Add(seconds(tm, 10), 10)
+	if len(store.entries) != 5 {
+		t.Error("expected eviction to drop once the store is unset")
+	}
+}
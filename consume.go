@@ -0,0 +1,63 @@
+package history
+
+import (
+	"context"
+	"errors"
+)
+
+// most entries Consume stores under one lock
+const consumeBatch = 256
+
+// stores the entries received on ch until ch is closed or ctx is done,
+// returning how many were received. entries are stored as AddBatch stores
+// them, so out of order entries are inserted in order and duplicates of
+// stored times skipped, which is not an error here. whatever is waiting on
+// ch is gathered, up to consumeBatch entries, and stored under one lock as
+// soon as ch runs dry, so an entry is never held back for more to arrive.
+// what was received before ctx is done is stored before returning ctx's
+// error. a nil error once ch is closed. stops early with ErrInconsistent.
+func (l *History[T]) Consume(ctx context.Context, ch <-chan Entry[T]) (int, error) {
+	n := 0
+	batch := make([]Entry[T], 0, consumeBatch)
+	flush := func() error {
+		err := l.AddBatch(batch)
+		clear(batch)
+		batch = batch[:0]
+		if errors.Is(err, ErrDuplicate) {
+			return nil
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case e, ok := <-ch:
+			if !ok {
+				return n, nil
+			}
+			batch = append(batch, e)
+			n++
+		}
+
+		closed := false
+	gather:
+		for len(batch) < consumeBatch {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					closed = true
+					break gather
+				}
+				batch = append(batch, e)
+				n++
+			default:
+				break gather
+			}
+		}
+		if err := flush(); err != nil || closed {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Consume stores everything sent, skipping duplicates, until ch closes
+func TestConsume(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	ch := make(chan Entry[int])
+	go func() {
+		for i := 999; i >= 0; i-- {
+			ch <- Entry[int]{Time: tm.Add(time.Duration(i) * time.Second), Item: i}
+		}
+		ch <- Entry[int]{Time: tm, Item: -1}
+		close(ch)
+	}()
+
+	n, err := lg.Consume(context.Background(), ch)
+	if err != nil || n != 1001 {
+		t.Error("expected 1001 received, got", n, err)
+	}
+	if it, ok := lg.Get(tm); lg.Len() != 1000 || !ok || it != 0 {
+		t.Error("expected 1000 stored with the duplicate skipped, got", lg.Len(), it)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// what was received before ctx is done is stored
+func TestConsumeCancelled(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	ch := make(chan Entry[int], 3)
+	for i := 0; i < 3; i++ {
+		ch <- Entry[int]{Time: time.Unix(int64(i), 0), Item: i}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for lg.Len() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	n, err := lg.Consume(ctx, ch)
+	if !errors.Is(err, context.Canceled) || n != 3 || lg.Len() != 3 {
+		t.Error("expected 3 stored before cancelling, got", n, lg.Len(), err)
+	}
+}
@@ -0,0 +1,46 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// position of a consumer reading a History with Next. it holds only the
+// time of the last entry read, so it can be saved with Position and made
+// again with NewCursor, and it stays valid as the History evicts: once the
+// entries after it are gone, Next resumes at the oldest remaining one.
+// consumers sharing a Cursor each get different entries.
+type Cursor struct {
+	mux   sync.Mutex
+	after time.Time
+}
+
+// cursor at which Next returns the entries after the given time
+func NewCursor(after time.Time) *Cursor {
+	return &Cursor{after: key(after)}
+}
+
+// time of the last entry read, or the time given to NewCursor before any
+func (c *Cursor) Position() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.after
+}
+
+// up to n entries after c, oldest first, moving c past them. entries
+// added later before c's position, out of order, are never returned.
+func (l *History[T]) Next(c *Cursor, n int) []Entry[T] {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo := indexAfter(l.times, c.after)
+	hi := lo + min(n, len(l.times)-lo)
+	if hi <= lo {
+		return nil
+	}
+	c.after = l.times[hi-1]
+	return l.entriesIn(lo, hi)
+}
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Next pages through the entries and picks up ones added later
+func TestCursorNext(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	c := NewCursor(tm)
+	if entries := lg.Next(c, 3); len(entries) != 3 || entries[0].Item != 1 || entries[2].Item != 3 {
+		t.Fatal("first Next got", entries)
+	}
+	if !c.Position().Equal(tm.Add(3 * time.Second)) {
+		t.Error("expected the cursor at the last entry read, got", c.Position())
+	}
+	if entries := lg.Next(c, 3); len(entries) != 1 || entries[0].Item != 4 {
+		t.Error("second Next got", entries)
+	}
+	if entries := lg.Next(c, 3); entries != nil {
+		t.Error("expected nothing new, got", entries)
+	}
+
+	lg.Add(tm.Add(5*time.Second), 5)
+	if entries := lg.Next(NewCursor(c.Position()), 3); len(entries) != 1 || entries[0].Item != 5 {
+		t.Error("expected a restored cursor to see the new entry, got", entries)
+	}
+}
+
+// a cursor whose position was evicted resumes at the oldest entry left
+func TestCursorEvicted(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Minute, 0)
+	tm := time.Unix(0, 0)
+	c := NewCursor(tm.Add(-time.Second))
+	lg.Add(tm, 0)
+	lg.Next(c, 1)
+
+	lg.Add(tm.Add(time.Hour), 1)
+	lg.Add(tm.Add(time.Hour+time.Second), 2)
+	if entries := lg.Next(c, 1); len(entries) != 1 || entries[0].Item != 1 {
+		t.Error("expected to resume at the oldest entry, got", entries)
+	}
+}
+
+// consumers sharing a cursor never get the same entry
+func TestCursorShared(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 1000; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	c := NewCursor(tm.Add(-time.Second))
+	var mux sync.Mutex
+	seen := make(map[int]int)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entries := lg.Next(c, 7); entries != nil; entries = lg.Next(c, 7) {
+				mux.Lock()
+				for _, e := range entries {
+					seen[e.Item]++
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 1000 {
+		t.Error("expected every entry read, got", len(seen))
+	}
+	for it, n := range seen {
+		if n != 1 {
+			t.Error("entry", it, "read", n, "times")
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package history
+
+import (
+	"time"
+)
+
+// state of a History at one moment, from Diagnostics, for debug pages
+type Report struct {
+	Length      time.Duration `json:"length"`      // eviction length, 0 or less for none
+	MinKeep     int           `json:"minKeep"`     // items kept regardless of age
+	Capacity    int           `json:"capacity"`    // max number of items, 0 for no limit
+	Count       int           `json:"count"`       // items stored
+	Oldest      time.Time     `json:"oldest"`      // time of the oldest item, zero if empty
+	Newest      time.Time     `json:"newest"`      // time of the newest item, zero if empty
+	Span        time.Duration `json:"span"`        // newest - oldest
+	Full        bool          `json:"full"`        // the items span length, or fill capacity
+	ApproxBytes int           `json:"approxBytes"` // estimate as from ApproxBytes
+	LastEvicted int           `json:"lastEvicted"` // items evicted by the last Add or Trim
+	AddRate     float64       `json:"addRate"`     // items per second over the span, 0 for fewer than two
+}
+
+// Report of l taken under one read lock, so that its fields agree with each
+// other where separate calls could each see a different state
+func (l *History[T]) Diagnostics() Report {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	r := Report{
+		Length:      l.length,
+		MinKeep:     l.minKeep,
+		Capacity:    l.capacity,
+		Count:       len(l.times),
+		ApproxBytes: l.approxBytes(),
+		LastEvicted: l.lastEvicted,
+	}
+	if len(l.times) > 0 {
+		r.Oldest, r.Newest = l.times[0], l.times[len(l.times)-1]
+		r.Span = r.Newest.Sub(r.Oldest)
+	}
+	r.Full = l.length > 0 && r.Span >= l.length || l.capacity > 0 && r.Count >= l.capacity
+	if r.Span > 0 {
+		r.AddRate = float64(r.Count-1) / r.Span.Seconds()
+	}
+	return r
+}
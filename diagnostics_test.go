@@ -0,0 +1,31 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Diagnostics agrees with the separate accessors
+func TestDiagnostics(t *testing.T) {
+	lg := MakeHistoryWithMin[int](10*time.Second, 0)
+	if r := lg.Diagnostics(); r.Count != 0 || r.Full || r.AddRate != 0 {
+		t.Error("unexpected report for an empty History", r)
+	}
+
+	tm := time.Unix(0, 0)
+	for i := 0; i <= 20; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	r := lg.Diagnostics()
+	if r.Count != lg.Len() || r.Count != 11 || !r.Oldest.Equal(tm.Add(10*time.Second)) || r.Span != 10*time.Second {
+		t.Error("unexpected report", r)
+	}
+	if !r.Full || r.LastEvicted != 1 || r.AddRate != 1 || r.ApproxBytes != lg.ApproxBytes() {
+		t.Error("unexpected report", r)
+	}
+
+	if _, err := json.Marshal(r); err != nil {
+		t.Error(err)
+	}
+}
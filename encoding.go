@@ -0,0 +1,225 @@
+package history
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// serialized form of a History, items are encoded as T encodes itself
+type encodedHistory[T any] struct {
+	Length   time.Duration `json:"length"`
+	MinKeep  int           `json:"minKeep"`
+	Capacity int           `json:"capacity,omitempty"`
+	Entries  []Entry[T]    `json:"entries"`
+}
+
+func (l *History[T]) MarshalJSON() ([]byte, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return json.Marshal(l.encoded())
+}
+
+// replaces the configuration and contents of l, then evicts as Add would.
+// options such as the clock are kept, a zero History gets the defaults.
+// times are rounded to WithResolution as Add rounds them, and entries that
+// round to one time fail with ErrDuplicate.
+func (l *History[T]) UnmarshalJSON(b []byte) error {
+	var h encodedHistory[T]
+	if err := json.Unmarshal(b, &h); err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.unlock()
+
+	return l.load(h.Length, h.MinKeep, h.Capacity, h.Entries)
+}
+
+func (l *History[T]) GobEncode() ([]byte, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(l.encoded()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// same as UnmarshalJSON for the gob encoding
+func (l *History[T]) GobDecode(b []byte) error {
+	var h encodedHistory[T]
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&h); err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	defer l.unlock()
+
+	return l.load(h.Length, h.MinKeep, h.Capacity, h.Entries)
+}
+
+// caller holds the lock
+func (l *History[T]) encoded() encodedHistory[T] {
+	return encodedHistory[T]{
+		Length:   l.length,
+		MinKeep:  l.minKeep,
+		Capacity: l.capacity,
+		Entries:  l.entries(),
+	}
+}
+
+// caller holds the lock. duplicate times are rejected, which keeps
+// times and the map the same length.
+func (l *History[T]) load(length time.Duration, minKeep int, capacity int, entries []Entry[T]) error {
+	if l.clock == nil {
+		l.options = makeOptions(nil)
+	}
+
+	t := make(map[time.Time]T, len(entries))
+	times := make([]time.Time, 0, len(entries))
+	for _, e := range entries {
+		e.Time = l.stamp(e.Time)
+		if _, ok := t[e.Time]; ok {
+			return fmt.Errorf("%w: %v", ErrDuplicate, e.Time)
+		}
+		t[e.Time] = e.Item
+		times = append(times, e.Time)
+	}
+	slices.SortStableFunc(times, func(a time.Time, b time.Time) int { return a.Compare(b) })
+	if err := validate(times, t); err != nil {
+		return err
+	}
+	if l.timeKey != nil {
+		for i := 1; i < len(times); i++ {
+			if l.timeKey(times[i-1]) == l.timeKey(times[i]) {
+				return fmt.Errorf("%w: %v and %v share a key", ErrDuplicate, times[i-1], times[i])
+			}
+		}
+	}
+
+	l.length = length
+	l.minKeep = max(minKeep, 0)
+	l.capacity = max(capacity, 0)
+	l.t = t
+	l.times = times
+	l.trimmed = 0
+	l.deadlines, l.expiries = nil, nil
+	l.weights = nil
+	l.labels = nil
+	l.seqs = nil
+	l.rekey()
+	clear(l.rolledTo)
+	l.reindex()
+	if l.seq {
+		for _, t := range times {
+			l.number(t)
+		}
+	}
+	var zero T
+	l.total = zero
+	if l.sum != nil {
+		for _, t := range times {
+			l.total = l.sum(l.total, l.t[t])
+		}
+	}
+	if l.sketch != nil {
+		l.sketch.reset()
+		for _, t := range times {
+			l.sketch.add(l.value(l.t[t]))
+		}
+	}
+	l.evict()
+	return nil
+}
+
+// writes a row per entry in the from, to window under the configured
+// bounds, as Range selects them: the RFC3339 time followed by the columns
+// from format. the window is copied first so the lock is not held while
+// writing.
+func (l *History[T]) WriteCSV(w io.Writer, from time.Time, to time.Time, format func(it T) []string) error {
+	entries, err := l.Range(from, to)
+	if err != nil && !errors.Is(err, ErrEmpty) {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	for _, e := range entries {
+		if err := cw.Write(append([]string{e.Time.Format(time.RFC3339Nano)}, format(e.Item)...)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writes every entry on its own line, oldest first, as its RFC3339 time and
+// the item formatted with %v. entries are copied first so the lock is not
+// held while writing.
+func (l *History[T]) Dump(w io.Writer) error {
+	for _, e := range l.Snapshot() {
+		if _, err := fmt.Fprintf(w, "%s %v\n", e.Time.Format(time.RFC3339Nano), e.Item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reader of the entries in the from, to window as newline delimited JSON,
+// one entry per line, oldest first. the window is copied when the reader is
+// made, so later writes don't show, but each entry is only encoded as it is
+// read. encode turns an entry into its JSON object, for items that don't
+// encode themselves usefully, and nil encodes the Entry with encoding/json.
+// an encode error is returned from Read and ends the stream.
+func (l *History[T]) NDJSONReader(from time.Time, to time.Time, encode func(e Entry[T]) ([]byte, error)) io.Reader {
+	entries, _ := l.Range(from, to)
+	if encode == nil {
+		encode = func(e Entry[T]) ([]byte, error) { return json.Marshal(e) }
+	}
+	return &ndjsonReader[T]{entries: entries, encode: encode}
+}
+
+type ndjsonReader[T any] struct {
+	entries []Entry[T] // entries left to encode
+	encode  func(e Entry[T]) ([]byte, error)
+	line    []byte // rest of the line being read
+	err     error
+}
+
+func (r *ndjsonReader[T]) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.line) == 0 {
+			if r.err != nil {
+				break
+			}
+			if len(r.entries) == 0 {
+				r.err = io.EOF
+				break
+			}
+			line, err := r.encode(r.entries[0])
+			if err != nil {
+				r.err = err
+				break
+			}
+			r.entries[0] = Entry[T]{}
+			r.entries = r.entries[1:]
+			r.line = append(slices.Clip(line), '\n')
+		}
+		c := copy(p[n:], r.line)
+		r.line = r.line[c:]
+		n += c
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, r.err
+}
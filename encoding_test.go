@@ -0,0 +1,210 @@
+package history
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// a History survives a JSON round trip
+func TestJSONRoundTrip(t *testing.T) {
+	lg := MakeHistoryWithMin[float64](time.Duration(1)*time.Hour, 3)
+	tm := time.Unix(1000, 0).UTC()
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), float64(i)/2)
+	}
+
+	b, err := json.Marshal(lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored History[float64]
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.length != lg.length || restored.minKeep != lg.minKeep {
+		t.Error("configuration incorrect:", restored.length, restored.minKeep)
+	}
+	want, got := lg.Snapshot(), restored.Snapshot()
+	if len(got) != len(want) {
+		t.Fatal("restored length", len(got), "expected", len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Item != want[i].Item {
+			t.Error("entry", i, "got", got[i], "expected", want[i])
+		}
+	}
+
+	if _, err := restored.Add(tm.Add(time.Minute), 42); err != nil {
+		t.Error("Add after restore failed:", err)
+	}
+}
+
+// loading sorts the entries and applies the configured window
+func TestJSONLoadEvicts(t *testing.T) {
+	b := []byte(`{"length":2000000000,"minKeep":0,"entries":[
+		{"time":"2020-01-01T00:00:05Z","item":5},
+		{"time":"2020-01-01T00:00:01Z","item":1},
+		{"time":"2020-01-01T00:00:04Z","item":4}]}`)
+
+	lg := MakeHistory[int](time.Hour)
+	if err := json.Unmarshal(b, lg); err != nil {
+		t.Fatal(err)
+	}
+	if p, _, _ := lg.Oldest(); lg.Len() != 2 || p != 4 {
+		t.Error("loaded history not evicted:", lg.Len(), p)
+	}
+
+	dup := []byte(`{"length":0,"minKeep":0,"entries":[
+		{"time":"2020-01-01T00:00:01Z","item":1},
+		{"time":"2020-01-01T00:00:01Z","item":2}]}`)
+	if err := json.Unmarshal(dup, lg); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+}
+
+// a History survives a gob round trip
+func TestGobRoundTrip(t *testing.T) {
+	lg := MakeHistoryWithMin[float64](time.Duration(1)*time.Hour, 3)
+	tm := time.Unix(1000, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), float64(i)/2)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(lg); err != nil {
+		t.Fatal(err)
+	}
+
+	var restored History[float64]
+	if err := gob.NewDecoder(&buf).Decode(&restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.length != lg.length || restored.minKeep != lg.minKeep {
+		t.Error("configuration incorrect:", restored.length, restored.minKeep)
+	}
+	want, got := lg.Snapshot(), restored.Snapshot()
+	if len(got) != len(want) || len(restored.t) != len(want) {
+		t.Fatal("restored length", len(got), len(restored.t), "expected", len(want))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Item != want[i].Item {
+			t.Error("entry", i, "got", got[i], "expected", want[i])
+		}
+	}
+}
+
+// WriteCSV writes the time then the formatted columns
+func TestWriteCSV(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	format := func(it int) []string { return []string{strconv.Itoa(it), strconv.Itoa(it * it)} }
+	if err := lg.WriteCSV(&buf, tm, tm.Add(time.Hour), format); err != nil || buf.Len() != 0 {
+		t.Error("WriteCSV on empty log:", err, buf.String())
+	}
+
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if err := lg.WriteCSV(&buf, tm.Add(time.Second), tm.Add(time.Duration(3)*time.Second), format); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "2020-01-01T00:00:01Z,1,1\n2020-01-01T00:00:02Z,2,4\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV wrote %q, expected %q", buf.String(), want)
+	}
+}
+
+// the same instant in two locations is two map keys but not two times
+func TestJSONEqualTimes(t *testing.T) {
+	tm := time.Unix(0, 0).UTC()
+	data := fmt.Sprintf(`{"length":3600000000000,"minKeep":0,"entries":[{"time":%q,"item":1},{"time":%q,"item":2}]}`,
+		tm.Format(time.RFC3339Nano), tm.In(time.FixedZone("X", 3600)).Format(time.RFC3339Nano))
+	var lg History[int]
+	if err := json.Unmarshal([]byte(data), &lg); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected inconsistent error, got", err)
+	}
+}
+
+// decoded times are rounded as added ones are, so lookups find them
+func TestJSONResolution(t *testing.T) {
+	tm := time.Unix(0, 0).UTC()
+	entries := fmt.Sprintf(`{"length":3600000000000,"minKeep":0,"entries":[{"time":%q,"item":1},{"time":%q,"item":2}]}`,
+		tm.Add(400*time.Millisecond).Format(time.RFC3339Nano), tm.Add(2100*time.Millisecond).Format(time.RFC3339Nano))
+	lg := MakeHistory[int](time.Hour, WithResolution(time.Second))
+	if err := json.Unmarshal([]byte(entries), lg); err != nil {
+		t.Fatal(err)
+	}
+	if it, ok := lg.Get(tm); !ok || it != 1 {
+		t.Error("expected the rounded time found, got", it, ok)
+	}
+	if it, ok := lg.Get(tm.Add(2 * time.Second)); !ok || it != 2 {
+		t.Error("expected the rounded time found, got", it, ok)
+	}
+
+	colliding := fmt.Sprintf(`{"length":3600000000000,"minKeep":0,"entries":[{"time":%q,"item":1},{"time":%q,"item":2}]}`,
+		tm.Add(100*time.Millisecond).Format(time.RFC3339Nano), tm.Add(200*time.Millisecond).Format(time.RFC3339Nano))
+	if err := json.Unmarshal([]byte(colliding), lg); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+}
+
+func TestDump(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0).UTC()
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Second), 2)
+
+	var buf bytes.Buffer
+	if err := lg.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "1970-01-01T00:00:00Z 1\n1970-01-01T00:00:01Z 2\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
+
+// the reader yields a line per entry of the window as it was when made
+func TestNDJSONReader(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0).UTC()
+	for i := 0; i < 3; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	r := lg.NDJSONReader(tm, tm.Add(time.Minute), nil)
+	lg.Add(tm.Add(10*time.Second), 10)
+	b, err := io.ReadAll(iotest.OneByteReader(r))
+	want := `{"time":"1970-01-01T00:00:00Z","item":0}
+{"time":"1970-01-01T00:00:01Z","item":1}
+{"time":"1970-01-01T00:00:02Z","item":2}
+`
+	if err != nil || string(b) != want {
+		t.Errorf("got %q, %v", b, err)
+	}
+
+	fail := errors.New("opaque item")
+	r = lg.NDJSONReader(tm, tm.Add(time.Minute), func(e Entry[int]) ([]byte, error) {
+		if e.Item == 2 {
+			return nil, fail
+		}
+		return []byte(strconv.Itoa(e.Item)), nil
+	})
+	if b, err := io.ReadAll(r); !errors.Is(err, fail) || string(b) != "0\n1\n" {
+		t.Errorf("expected the lines before the encode error, got %q, %v", b, err)
+	}
+}
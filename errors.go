@@ -0,0 +1,26 @@
+package history
+
+import (
+	"errors"
+)
+
+var (
+	ErrEmpty           = errors.New("empty log")                             // no items stored
+	ErrNoValues        = errors.New("timed log: no values to avg")           // no items in the queried window
+	ErrBeforeStart     = errors.New("wanted time before log start")          // query precedes the oldest item
+	ErrAfterEnd        = errors.New("wanted time at or after log end")       // query at or past the newest item
+	ErrNotFound        = errors.New("not found")                             // item not stored
+	ErrDuplicate       = errors.New("duplicate timestamp")                   // an item is already stored at that time
+	ErrPercentile      = errors.New("percentile not in [0, 1]")              // percentile argument out of range
+	ErrInterval        = errors.New("interval not positive")                 // bucket or step width out of range
+	ErrBuckets         = errors.New("number of buckets not positive")        // histogram bucket count out of range
+	ErrTooFew          = errors.New("too few values")                        // the window has values but not enough of them
+	ErrInconsistent    = errors.New("History in inconsistent state")         // times and items disagree
+	ErrStale           = errors.New("item too old")                          // the item found is older than allowed
+	ErrTooOld          = errors.New("time before the eviction cutoff")       // the item would be evicted as soon as added
+	ErrNotTracked      = errors.New("not tracked")                           // the History was not set up to track this
+	ErrNotAggregatable = errors.New("item type lacks an aggregation method") // T does not implement Adder, Divider or Comparer
+	ErrPanic           = errors.New("callback panicked")                     // a callback panicked under WithRecover
+	ErrLockTimeout     = errors.New("lock not acquired in time")             // the context was done before the lock was free
+	ErrFuture          = errors.New("time too far ahead of the clock")       // the item is further ahead than WithMaxFutureSkew allows
+)
@@ -0,0 +1,47 @@
+package history
+
+import (
+	"time"
+)
+
+// History of float64 with the arithmetic bound in, so the window methods
+// take no callbacks. the methods named as in History shadow the generic
+// ones, which stay reachable through the embedded History.
+type FloatHistory struct {
+	*History[float64]
+}
+
+func MakeFloatHistory(d time.Duration, opts ...Option) FloatHistory {
+	return FloatHistory{MakeHistory[float64](d, opts...)}
+}
+
+func addFloat(a float64, b float64) float64 { return a + b }
+func divFloat(a float64, n int) float64     { return a / float64(n) }
+func lessFloat(a float64, b float64) bool   { return a < b }
+
+// mean of the items in the from, to window, ErrNoValues if there are none
+func (l FloatHistory) AvgBetween(from time.Time, to time.Time) (float64, error) {
+	return l.History.AvgBetween(from, to, addFloat, divFloat)
+}
+
+// mean over the trailing window from the clock's now minus d to now
+func (l FloatHistory) AvgSince(d time.Duration) (float64, error) {
+	return l.History.AvgSince(d, addFloat, divFloat)
+}
+
+// sum of the items in the from, to window, 0 if there are none
+func (l FloatHistory) SumBetween(from time.Time, to time.Time) (float64, error) {
+	return l.History.SumBetween(from, to, addFloat)
+}
+
+func (l FloatHistory) MinBetween(from time.Time, to time.Time) (float64, time.Time, error) {
+	return l.History.MinBetween(from, to, lessFloat)
+}
+
+func (l FloatHistory) MaxBetween(from time.Time, to time.Time) (float64, time.Time, error) {
+	return l.History.MaxBetween(from, to, lessFloat)
+}
+
+func (l FloatHistory) PercentileBetween(from time.Time, to time.Time, p float64) (float64, error) {
+	return l.History.PercentileBetween(from, to, p, lessFloat)
+}
@@ -0,0 +1,31 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloatHistory(t *testing.T) {
+	lg := MakeFloatHistory(time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{3, 1, 4, 1, 5} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	end := tm.Add(time.Minute)
+
+	if avg, err := lg.AvgBetween(tm, end); err != nil || avg != 2.8 {
+		t.Error("expected avg 2.8, got", avg, err)
+	}
+	if sum, _ := lg.SumBetween(tm, end); sum != 14 {
+		t.Error("expected sum 14, got", sum)
+	}
+	if low, then, _ := lg.MinBetween(tm, end); low != 1 || !then.Equal(tm.Add(time.Second)) {
+		t.Error("expected the first 1, got", low, then)
+	}
+	if high, _, _ := lg.MaxBetween(tm, end); high != 5 {
+		t.Error("expected max 5, got", high)
+	}
+	if med, _ := lg.PercentileBetween(tm, end, 0.5); med != 3 {
+		t.Error("expected median 3, got", med)
+	}
+}
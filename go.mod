@@ -0,0 +1,3 @@
+module github.com/prateshg/history
+
+go 1.22
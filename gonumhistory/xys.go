@@ -0,0 +1,25 @@
+// converts a History to gonum's plotter.XYs for charting. kept apart from
+// the history package so only users of this adapter depend on gonum.
+package gonumhistory
+
+import (
+	"time"
+
+	"github.com/prateshg/history"
+	"gonum.org/v1/plot/plotter"
+)
+
+// the items of h in the from, to window as plotter.XYs, oldest first, X
+// being the time as seconds since the Unix epoch and Y given by y.
+// ErrEmpty for an empty log, as History.XYs.
+func XYs[T any](h *history.History[T], from time.Time, to time.Time, y func(it T) float64) (plotter.XYs, error) {
+	xys, err := h.XYs(from, to, y)
+	if err != nil {
+		return nil, err
+	}
+	out := make(plotter.XYs, len(xys))
+	for i, p := range xys {
+		out[i].X, out[i].Y = p.X, p.Y
+	}
+	return out, nil
+}
@@ -0,0 +1,28 @@
+package gonumhistory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prateshg/history"
+)
+
+func TestXYs(t *testing.T) {
+	tm := time.Unix(1000, 0)
+	h := history.MakeHistory[float64](time.Hour)
+	if _, err := XYs(h, tm, tm, nil); !errors.Is(err, history.ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	for i := 0; i < 3; i++ {
+		h.Add(tm.Add(time.Duration(i)*time.Second), float64(i)*2)
+	}
+
+	xys, err := XYs(h, tm, tm.Add(time.Hour), func(it float64) float64 { return it })
+	if err != nil || xys.Len() != 3 {
+		t.Fatal("XYs got", xys, err)
+	}
+	if x, y := xys.XY(2); x != 1002 || y != 4 {
+		t.Error("expected 1002, 4, got", x, y)
+	}
+}
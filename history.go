@@ -1,76 +1,1575 @@
 package history
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
+	"unsafe"
 )
 
-type History struct {
-	length time.Duration             // constraint on newest time - oldest time
-	t      map[time.Time]HistoryItem // time -> item
-	times  []time.Time               // sorted slice of keys in map
-	mux    sync.Mutex                // for thread-safeness
+// number of items kept regardless of age by MakeHistory
+const defaultMinKeep = 100
+
+// items scanned between checks of the context in the Ctx methods
+const ctxCheckEvery = 1024
+
+// store and query items of type T by time.
+//
+// methods taking a from, to window select items by the bounds set with
+// WithBounds, [from, to) unless configured otherwise. entries are always
+// returned in an order taken from the sorted times, never from map
+// iteration, so output is the same from run to run.
+//
+// on Add the oldest items are evicted while the log holds more than
+// capacity items, then while newest - oldest exceeds length and more than
+// minKeep items remain. capacity is a hard limit and wins over minKeep.
+// a length of 0 or less disables eviction by age. Trim, or every read with
+// WithAutoTrim, evicts by age relative to the clock's now instead. items
+// added with AddWithTTL are also evicted once their own TTL expires.
+//
+// writers take the write lock and readers share the read lock for as long as
+// they scan, so a long aggregate over a big window holds off Adds until it
+// ends. to keep Adds flowing, copy the window with Range and compute on the
+// copy. BenchmarkReadWhileAdding measures the contention.
+//
+// items are copied into the map on Add and out of it into every entry
+// returned, which for a large struct costs more than the lookup. a
+// History[*T] stores pointers instead, so Range and the rest copy a word
+// per item, though the items are then shared: one mutated after Add is
+// seen by readers without the lock, so treat them as immutable. give
+// WithItemSize the size pointed to for ApproxBytes to count it, and scan
+// with ForEach to read without building a slice at all.
+// BenchmarkRangeLarge compares the two.
+type History[T any] struct {
+	options
+	length   time.Duration   // constraint on newest time - oldest time, none if <= 0
+	minKeep  int             // number of items kept regardless of length
+	capacity int             // maximum number of items, 0 for no limit
+	t        map[time.Time]T // time -> item
+	times    []time.Time     // sorted slice of keys in map
+	mux      sync.RWMutex    // for thread-safeness, readers share the lock
+
+	byteBudget int            // max bytes estimated held, 0 for no limit
+	policy     EvictionPolicy // evicts on top of the limits above, nil for none
+
+	autoTarget   int           // number of items AutoDuration sizes length for, 0 when off
+	meanInterval time.Duration // smoothed time between newest items for AutoDuration
+
+	onEvict func(t time.Time, it T)      // called for each evicted entry
+	evictIf func(t time.Time, it T) bool // evicts matching entries on Add
+	cold    ColdStore[T]                 // given each batch of evicted entries, nil to drop them
+
+	subs    *subscribers[T] // channels told of stored entries, nil until Subscribe
+	nsubs   int             // number of open subscriptions
+	added   []Entry[T]      // stored under the lock, sent to subs after
+	evicted []Entry[T]      // evicted under the lock, passed to cold and onEvict after
+
+	trimmed     int  // times cut off the front of the backing array since it was allocated
+	floored     bool // minKeep held back eviction by age on the last Add, for WithLogger
+	lastEvicted int  // number of items the last eviction pass removed, for Diagnostics
+
+	deadlines map[time.Time]time.Time // expiry of the items added with a TTL
+	expiries  deadlineHeap            // the same deadlines, soonest first
+
+	weights map[time.Time]float64           // weight of the items added with AddWeighted other than 1
+	labels  map[time.Time]map[string]string // labels of the items added with AddTagged
+
+	seqs    map[time.Time]uint64 // Seq of each item with WithSeq, nil without
+	lastSeq uint64               // Seq given to the last item stored
+
+	keys map[int64]time.Time // stored time of each WithTimeKey key, nil without
+
+	roll     func(items []T) T // rolls a bucket of items up into one, nil unless Rollup was called
+	tiers    []Tier            // Rollup tiers, by After
+	rolledTo []time.Time       // end of the buckets each tier has rolled up
+
+	equal       func(a T, b T) bool // drops an Add repeating the previous item, nil unless Coalesce was called
+	minInterval time.Duration       // how long a repeat is dropped for after the previous item
+
+	sum   func(a T, b T) T // adds an item to total, nil unless TrackSum was called
+	sub   func(a T, b T) T // takes an item off total
+	total T                // sum of all stored items when tracked
+
+	value  func(it T) float64 // maps items into sketch, nil unless TrackQuantiles was called
+	sketch *quantileSketch    // approximate distribution of all stored items
+
+	valueOf func(it T) float64 // maps items into byValue, nil unless IndexValues was called
+	byValue *valueIndex        // the stored items sorted by valueOf
+}
+
+// history evicting items more than d older than the newest, keeping at
+// least defaultMinKeep. a d of 0 or less keeps everything.
+func MakeHistory[T any](d time.Duration, opts ...Option) *History[T] {
+	return MakeHistoryWithMin[T](d, defaultMinKeep, opts...)
+}
+
+// history keeping at least minKeep items even when older than d.
+// a minKeep of 0 evicts purely by time, negative values are treated as 0.
+func MakeHistoryWithMin[T any](d time.Duration, minKeep int, opts ...Option) *History[T] {
+	l := MakeHistoryWithPolicy[T](nil, opts...)
+	l.length, l.minKeep = d, max(minKeep, 0)
+	return l
+}
+
+// history keeping the newest maxItems items regardless of their age
+func MakeHistoryWithCapacity[T any](maxItems int, opts ...Option) *History[T] {
+	l := MakeHistoryWithPolicy[T](nil, opts...)
+	l.capacity = max(maxItems, 0)
+	return l
+}
+
+// history kept to roughly maxBytes, evicting the oldest items on Add while
+// the estimate is over budget and more than minKeep remain, 0 unless set
+// with UpdateMinKeep. the estimate is that of ApproxBytes with itemSize
+// bytes per item and the times slice taken at its length, so it is only as
+// good as itemSize and ignores memory the items point to.
+func MakeHistoryWithByteBudget[T any](maxBytes int, itemSize int, opts ...Option) *History[T] {
+	l := MakeHistoryWithPolicy[T](nil, append(opts, WithItemSize(itemSize))...)
+	l.byteBudget = max(maxBytes, 0)
+	return l
+}
+
+// untyped History, for callers predating the generic History.
+// MakeHistory(d) becomes MakeAnyHistory(d) or MakeHistory[HistoryItem](d),
+// and AvgBetween no longer takes a zero value.
+type AnyHistory = History[HistoryItem]
+
+func MakeAnyHistory(d time.Duration, opts ...Option) *AnyHistory {
+	return MakeHistory[HistoryItem](d, opts...)
+}
+
+// sets the length used from the next Add, 0 or less disables eviction by age.
+// turns off AutoDuration.
+func (l *History[T]) UpdateDuration(d time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.length = d
+	l.autoTarget = 0
+}
+
+// weight of the newest interval in the mean AutoDuration keeps
+const autoDurationAlpha = 0.1
+
+// sizes length to hold about n items at the rate they arrive. every Add of
+// a newest item folds the time since the previous newest into an
+// exponentially weighted mean interval, each new interval weighing
+// autoDurationAlpha, and sets length to n-1 mean intervals, at least one.
+// late inserts leave the mean alone. minKeep still holds back eviction and
+// capacity still caps it. an n of 0 or less turns it off, keeping the last length.
+func (l *History[T]) AutoDuration(n int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.autoTarget = max(n, 0)
+	l.meanInterval = 0
+}
+
+// caller holds the lock. folds the interval up to a new newest item into
+// the mean for AutoDuration
+func (l *History[T]) tuneLength(interval time.Duration) {
+	if l.meanInterval == 0 {
+		l.meanInterval = interval
+	} else {
+		l.meanInterval += time.Duration(autoDurationAlpha * float64(interval-l.meanInterval))
+	}
+	l.length = l.meanInterval * time.Duration(max(l.autoTarget-1, 1))
+}
+
+// negative values are treated as 0
+func (l *History[T]) UpdateMinKeep(n int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.minKeep = max(n, 0)
+}
+
+// fn is called with each entry evicted, whether for length, capacity, a TTL
+// or EvictIf, after the lock is released so it may call back into the
+// History. calls from concurrent Adds may interleave. nil removes the hook.
+func (l *History[T]) OnEvict(fn func(t time.Time, it T)) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.onEvict = fn
+}
+
+// on every Add, after the age and capacity checks, also evict the entries
+// for which fn returns true. fn is evaluated from the oldest forward under
+// the lock, so it must not call back into the History, and evaluation stops
+// once only minKeep entries remain. this is a pass over all entries on
+// every Add. nil removes the rule.
+func (l *History[T]) EvictIf(fn func(t time.Time, it T) bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.evictIf = fn
+}
+
+// takes effect on the next Add, n <= 0 removes the limit
+func (l *History[T]) UpdateCapacity(n int) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.capacity = max(n, 0)
+}
+
+func (l *History[T]) Len() int {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return len(l.times)
+}
+
+// stores it at time t, returning the stored entry. an item already stored
+// at exactly t is kept and ErrDuplicate returned, use AddOrReplace to
+// overwrite it instead. nothing is stored and ErrInconsistent returned if
+// the History is in an inconsistent state.
+func (l *History[T]) Add(t time.Time, it T) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	e, _, err := l.insert("Add", l.stored(l.stamp(t)), it)
+	return e, err
+}
+
+// stores it at the clock's current time, read under the lock so concurrent
+// AddNow calls are stored in the order they get the lock. this is the
+// recommended way to record live data.
+func (l *History[T]) AddNow(it T) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	e, _, err := l.insert("AddNow", l.stored(l.stamp(l.clock.Now())), it)
+	return e, err
+}
+
+// caller holds the lock and has stamped t. the checks of Add and its
+// variants, timed as op, then storing it at t. ErrInconsistent,
+// ErrDuplicate or the rejects error if it can't be stored, or the entry
+// that Coalesce or WithIngestInterval keeps instead of it. kept says
+// whether it was stored and survived the eviction that followed, for the
+// variants that attach data to it.
+func (l *History[T]) insert(op string, t time.Time, it T) (_ Entry[T], kept bool, _ error) {
+	if l.latencies != nil {
+		defer l.latencies.record(op, time.Now())
+	}
+
+	if err := l.consistent(); err != nil {
+		return Entry[T]{}, false, err
+	}
+	if _, ok := l.t[t]; ok {
+		l.warn("duplicate timestamp", slog.Time("time", t))
+		return Entry[T]{}, false, fmt.Errorf("%w: %v", ErrDuplicate, t)
+	}
+	if prev, ok := l.repeats(t, it); ok {
+		return prev, false, nil
+	}
+	if newest, ok := l.throttled(t); ok {
+		return newest, false, nil
+	}
+
+	if err := l.rejects(t); err != nil {
+		return Entry[T]{}, false, err
+	}
+	e := l.add(t, it)
+	_, kept = l.t[t]
+	return e, kept, nil
+}
+
+// stores it at time t, replacing any item already stored at exactly t.
+// errors only if the History is in an inconsistent state.
+func (l *History[T]) AddOrReplace(t time.Time, it T) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+	if l.latencies != nil {
+		defer l.latencies.record("AddOrReplace", time.Now())
+	}
+
+	t = l.stored(l.stamp(t))
+	if err := l.consistent(); err != nil {
+		return Entry[T]{}, err
+	}
+	if _, ok := l.t[t]; ok {
+		l.put(t, it)
+		return l.entryAt(t), nil
+	}
+
+	if err := l.rejects(t); err != nil {
+		return Entry[T]{}, err
+	}
+	return l.add(t, it), nil
+}
+
+// only store changes of state: Add and AddNow then drop an item equal to
+// the one stored at or before its time, if that was stored less than
+// minInterval earlier, and return the previous entry instead. min interval
+// 0 or less drops every repeat. Before and Range then give the value last
+// changed to, as fits step signals. nil equal stores every item again.
+func (l *History[T]) Coalesce(equal func(a T, b T) bool, minInterval time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.equal, l.minInterval = equal, minInterval
+}
+
+// caller holds the lock. the previous entry if Coalesce drops it at t
+func (l *History[T]) repeats(t time.Time, it T) (Entry[T], bool) {
+	if l.equal == nil {
+		return Entry[T]{}, false
+	}
+	i := indexAfter(l.times, t)
+	if i == 0 {
+		return Entry[T]{}, false
+	}
+	prev := l.entryAt(l.times[i-1])
+	if !l.equal(prev.Item, it) || (l.minInterval > 0 && t.Sub(prev.Time) >= l.minInterval) {
+		return Entry[T]{}, false
+	}
+	return prev, true
+}
+
+// caller holds the lock. the newest entry if WithIngestInterval drops t
+func (l *History[T]) throttled(t time.Time) (Entry[T], bool) {
+	if l.ingestEvery <= 0 || len(l.times) == 0 {
+		return Entry[T]{}, false
+	}
+	newest := l.times[len(l.times)-1]
+	if d := t.Sub(newest); d >= l.ingestEvery || d <= -l.ingestEvery {
+		return Entry[T]{}, false
+	}
+	return l.entryAt(newest), true
+}
+
+// caller holds the lock. with WithMaxFutureSkew, ErrFuture if t is too far
+// ahead of the clock. with WithRejectEvicted, ErrTooOld if an item at t
+// would be evicted as soon as it was added: older than newest - length with
+// minKeep items already stored, or older than the oldest with the History
+// at capacity.
+func (l *History[T]) rejects(t time.Time) error {
+	if l.maxSkew > 0 {
+		if ahead := t.Sub(l.clock.Now()); ahead > l.maxSkew {
+			return fmt.Errorf("%w: %v is %v ahead", ErrFuture, t, ahead)
+		}
+	}
+	if !l.rejectEvicted || len(l.times) == 0 {
+		return nil
+	}
+	if l.capacity > 0 && len(l.times) >= l.capacity && t.Before(l.times[0]) {
+		return fmt.Errorf("%w: %v precedes the oldest of %d items at capacity", ErrTooOld, t, l.capacity)
+	}
+	newest := l.times[len(l.times)-1]
+	if l.length > 0 && len(l.times) >= l.minKeep && newest.Sub(t) > l.length {
+		return fmt.Errorf("%w: %v is %v before the newest item", ErrTooOld, t, newest.Sub(t))
+	}
+	return nil
+}
+
+// caller holds the lock and has checked t is not stored yet.
+// appending the newest time is O(1), a late arrival is inserted in
+// order at O(n) cost for shifting the newer times up.
+func (l *History[T]) add(t time.Time, it T) Entry[T] {
+	if i := indexAfter(l.times, t); i == len(l.times) {
+		if l.autoTarget > 0 && i > 0 {
+			l.tuneLength(t.Sub(l.times[i-1]))
+		}
+		l.times = append(l.times, t)
+	} else {
+		l.warn("out of order insert", slog.Time("time", t), slog.Time("newest", l.times[len(l.times)-1]))
+		l.times = slices.Insert(l.times, i, t)
+		l.unroll(t)
+	}
+	l.put(t, it)
+	if l.observer != nil {
+		l.observer.ObserveAdd()
+	}
+
+	e := l.entryAt(t)
+	l.evict()
+	return e
+}
+
+// caller holds the lock. logs a data quality problem with WithLogger
+func (l *History[T]) warn(msg string, attrs ...slog.Attr) {
+	if l.logger != nil {
+		l.logger.LogAttrs(context.Background(), slog.LevelWarn, msg, attrs...)
+	}
+}
+
+// times are stored and looked up without their monotonic clock reading, so
+// a time from time.Now and the same time parsed or copied from elsewhere are
+// one key. the location is kept, so equal instants in different locations
+// are still distinct keys.
+func key(t time.Time) time.Time {
+	return t.Round(0)
+}
+
+// caller holds the lock. with WithTimeKey the time stored under t's key,
+// if any, so that it matches t; otherwise t itself
+func (l *History[T]) stored(t time.Time) time.Time {
+	if l.timeKey != nil {
+		if s, ok := l.keys[l.timeKey(t)]; ok {
+			return s
+		}
+	}
+	return t
+}
+
+// caller holds the lock. rebuilds the WithTimeKey keys from times
+func (l *History[T]) rekey() {
+	if l.timeKey == nil {
+		return
+	}
+	l.keys = make(map[int64]time.Time, len(l.times))
+	for _, t := range l.times {
+		l.keys[l.timeKey(t)] = t
+	}
+}
+
+// the time an item added at t is stored at, rounded with WithResolution
+func (o *options) stamp(t time.Time) time.Time {
+	if o.resolution > 0 {
+		return t.Round(o.resolution)
+	}
+	return key(t)
+}
+
+// caller holds the lock. adding to an inconsistent History would spread
+// the damage, so writers refuse with this error instead.
+func (l *History[T]) consistent() error {
+	if len(l.times) != len(l.t) {
+		return fmt.Errorf("%w: %v %v", ErrInconsistent, len(l.times), len(l.t))
+	}
+	return nil
+}
+
+// checks the invariants tying times to the map: equal lengths, times
+// strictly increasing and every time stored as a key. errors wrap
+// ErrInconsistent. O(n), meant for tests and health checks.
+func (l *History[T]) Validate() error {
+	l.rlock()
+	defer l.mux.RUnlock()
+	return validate(l.times, l.t)
+}
+
+// rebuilds times from the map keys, sorted, returning how many
+// discrepancies were fixed, 0 for a consistent History: times without an
+// item, times repeated, items missing from times, and times out of order.
+// the map is the source of truth, as it holds the items, so a time without
+// an item is dropped rather than an item invented for it. the tracked sum
+// and quantiles are recomputed and TTLs, weights, labels and Seqs of
+// dropped times forgotten. a recovery path after Validate fails.
+func (l *History[T]) Repair() int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	fixed := 0
+	seen := make(map[time.Time]bool, len(l.times))
+	times := make([]time.Time, 0, len(l.t))
+	for _, t := range l.times {
+		if _, ok := l.t[t]; !ok || seen[t] {
+			fixed++
+			continue
+		}
+		if n := len(times); n > 0 && !times[n-1].Before(t) {
+			fixed++
+		}
+		seen[t] = true
+		times = append(times, t)
+	}
+	for t := range l.t {
+		if !seen[t] {
+			fixed++
+			times = append(times, t)
+		}
+	}
+	if fixed == 0 {
+		return 0
+	}
+
+	slices.SortFunc(times, func(a time.Time, b time.Time) int { return a.Compare(b) })
+	l.times = times
+	maps.DeleteFunc(l.deadlines, func(t time.Time, _ time.Time) bool { _, ok := l.t[t]; return !ok })
+	maps.DeleteFunc(l.weights, func(t time.Time, _ float64) bool { _, ok := l.t[t]; return !ok })
+	maps.DeleteFunc(l.labels, func(t time.Time, _ map[string]string) bool { _, ok := l.t[t]; return !ok })
+	maps.DeleteFunc(l.seqs, func(t time.Time, _ uint64) bool { _, ok := l.t[t]; return !ok })
+	l.rekey()
+	l.reindex()
+	if l.sum != nil {
+		var zero T
+		l.total = zero
+		for _, t := range l.times {
+			l.total = l.sum(l.total, l.t[t])
+		}
+	}
+	if l.sketch != nil {
+		l.sketch.reset()
+		for _, t := range l.times {
+			l.sketch.add(l.value(l.t[t]))
+		}
+	}
+	return fixed
+}
+
+func validate[T any](times []time.Time, t map[time.Time]T) error {
+	if len(times) != len(t) {
+		return fmt.Errorf("%w: %v times for %v items", ErrInconsistent, len(times), len(t))
+	}
+	for i, tm := range times {
+		if i > 0 && !times[i-1].Before(tm) {
+			return fmt.Errorf("%w: times not increasing at %d: %v, %v", ErrInconsistent, i, times[i-1], tm)
+		}
+		if _, ok := t[tm]; !ok {
+			return fmt.Errorf("%w: no item for %v", ErrInconsistent, tm)
+		}
+	}
+	return nil
+}
+
+// caller holds the lock
+func (l *History[T]) evict() {
+	if l.roll != nil {
+		l.rollUp()
+	}
+	n := len(l.times)
+	l.retain()
+	l.evictedSince(n)
+}
+
+// caller holds the lock. records that an eviction pass took the History
+// from n items to its current count, for Diagnostics and the observer
+func (l *History[T]) evictedSince(n int) int {
+	l.lastEvicted = n - len(l.times)
+	if l.observer != nil {
+		l.observer.ObserveEvict(l.lastEvicted)
+	}
+	return l.lastEvicted
+}
+
+// caller holds the lock. evicts what the limits no longer retain
+func (l *History[T]) retain() {
+	if len(l.expiries) > 0 {
+		l.expire(l.clock.Now())
+	}
+	if len(l.times) == 0 {
+		return
+	}
+
+	// the safety ceiling is meant never to be reached, so say when it is
+	if l.maxEntries > 0 && len(l.times) > l.maxEntries {
+		l.warn("max entries reached, evicted oldest", slog.Int("maxEntries", l.maxEntries), slog.Int("evicted", len(l.times)-l.maxEntries))
+	}
+	for range min(l.retention().Evict(l.times), len(l.times)) {
+		l.evictOldest()
+	}
+	// a budget below one item can leave nothing to measure length against
+	if len(l.times) == 0 {
+		l.reslice()
+		return
+	}
+
+	lastTime := l.times[len(l.times)-1]
+	floored := l.length > 0 && len(l.times) == l.minKeep && lastTime.Sub(l.times[0]) > l.length
+	if floored && !l.floored {
+		l.warn("minKeep holds items older than length", slog.Int("minKeep", l.minKeep), slog.Time("oldest", l.times[0]))
+	}
+	l.floored = floored
+
+	if l.evictIf != nil {
+		l.evictMatching()
+	}
+	l.reslice()
+}
+
+// caller holds the lock. drops the entries matching evictIf, oldest first,
+// down to minKeep
+func (l *History[T]) evictMatching() {
+	kept := l.times[:0]
+	for i, t := range l.times {
+		if len(kept)+len(l.times)-i > l.minKeep && l.evictIf(t, l.t[t]) {
+			if l.onEvict != nil || l.cold != nil {
+				l.evicted = append(l.evicted, l.entryAt(t))
+			}
+			l.del(t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	clear(l.times[len(kept):])
+	l.times = kept
+}
+
+func (l *History[T]) evictOldest() {
+	rem := l.times[0]
+	if l.onEvict != nil || l.cold != nil {
+		l.evicted = append(l.evicted, l.entryAt(rem))
+	}
+	l.del(rem)
+	l.times = l.times[1:]
+	l.trimmed++
+}
+
+// caller holds the lock. cutting times off the front keeps the whole
+// backing array alive, so once more dead times sit in front than live ones
+// remain the live ones are moved to a fresh array. amortized O(1) per cut.
+func (l *History[T]) reslice() {
+	if l.trimmed > len(l.times) {
+		l.times = slices.Clone(l.times)
+		l.trimmed = 0
+	}
+}
+
+// reallocates times and the map at their current size, releasing memory
+// held from when the History was larger. Go maps never shrink on their own.
+func (l *History[T]) Compact() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.times = slices.Clip(slices.Clone(l.times))
+	l.trimmed = 0
+	t := make(map[time.Time]T, len(l.t))
+	maps.Copy(t, l.t)
+	l.t = t
+}
+
+// evicts the items more than length older than the clock's now, still
+// keeping minKeep, and returns how many went. Add evicts relative to the
+// newest item, so without Trim items outlive length once Adds stop. a
+// length of 0 or less never trims by age. items whose TTL expired go too.
+func (l *History[T]) Trim() int {
+	l.mux.Lock()
+	defer l.unlock()
+
+	return l.trim(l.clock.Now())
+}
+
+// one round of the maintenance Add does, for sources that go quiet: runs
+// the eviction an Add would, including rollups, capacity and policy, then
+// Trim's eviction by the clock's now, reported to the observer as one
+// pass, and shrinks times once more than half its capacity, and more than
+// WithInitialCapacity made room for, is spare. returns how many items went.
+// minKeep is respected as on Add and Trim. meant to be driven from the
+// caller's own timer, the History starts no goroutine. the map is left to
+// Compact, which copies it whole.
+func (l *History[T]) Tick() int {
+	l.mux.Lock()
+	defer l.unlock()
+
+	if l.roll != nil {
+		l.rollUp()
+	}
+	n := len(l.times)
+	l.retain()
+	l.trimTo(l.clock.Now())
+	if cap(l.times) > max(l.initialCap, 2*len(l.times)) {
+		times := make([]time.Time, len(l.times), max(l.initialCap, len(l.times)))
+		copy(times, l.times)
+		l.times = times
+		l.trimmed = 0
+	}
+	return l.evictedSince(n)
+}
+
+// caller holds the lock
+func (l *History[T]) trim(now time.Time) int {
+	n := len(l.times)
+	l.trimTo(now)
+	return l.evictedSince(n)
+}
+
+// caller holds the lock. evicts the items stale or expired at now
+func (l *History[T]) trimTo(now time.Time) {
+	l.expire(now)
+	for l.stale(now) {
+		l.evictOldest()
+	}
+	l.reslice()
+}
+
+// caller holds the lock. whether Trim would evict the oldest item
+func (l *History[T]) stale(now time.Time) bool {
+	return l.length > 0 && len(l.times) > l.minKeep && now.Sub(l.times[0]) > l.length
+}
+
+// takes the read lock, trimming first if WithAutoTrim was given. the
+// staleness check shares the read lock so reads only contend when there is
+// something to trim.
+func (l *History[T]) rlock() {
+	if l.autoTrim {
+		l.mux.RLock()
+		now := l.clock.Now()
+		stale := l.stale(now) || l.expiring(now)
+		l.mux.RUnlock()
+		if stale {
+			l.Trim()
+		}
+	}
+	l.mux.RLock()
+}
+
+// releases the write lock, then passes what was evicted under it to the
+// cold store and onEvict and what was stored to the subscribers
+func (l *History[T]) unlock() {
+	evicted, onEvict, cold := l.evicted, l.onEvict, l.cold
+	added, subs := l.added, l.subs
+	l.evicted, l.added = nil, nil
+	l.mux.Unlock()
+
+	if cold != nil && len(evicted) > 0 {
+		cold.Put(evicted)
+	}
+	if onEvict != nil {
+		for _, e := range evicted {
+			onEvict(e.Time, e.Item)
+		}
+	}
+	if len(added) > 0 {
+		subs.send(added)
+	}
+}
+
+// independent copy with the same configuration and entries
+func (l *History[T]) Clone() *History[T] {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	c := &History[T]{
+		options:  l.options,
+		length:   l.length,
+		minKeep:  l.minKeep,
+		capacity: l.capacity,
+		t:        maps.Clone(l.t),
+		times:    slices.Clone(l.times),
+		sum:      l.sum,
+		sub:      l.sub,
+		total:    l.total,
+
+		deadlines: maps.Clone(l.deadlines),
+		expiries:  slices.Clone(l.expiries),
+		weights:   maps.Clone(l.weights),
+		labels:    maps.Clone(l.labels),
+		seqs:      maps.Clone(l.seqs),
+		lastSeq:   l.lastSeq,
+		keys:      maps.Clone(l.keys),
+
+		roll:     l.roll,
+		tiers:    l.tiers,
+		rolledTo: slices.Clone(l.rolledTo),
+
+		byteBudget:   l.byteBudget,
+		policy:       l.policy,
+		autoTarget:   l.autoTarget,
+		meanInterval: l.meanInterval,
+
+		evictIf:     l.evictIf,
+		equal:       l.equal,
+		minInterval: l.minInterval,
+	}
+	if l.sketch != nil {
+		c.value, c.sketch = l.value, l.sketch.clone()
+	}
+	if l.byValue != nil {
+		c.valueOf, c.byValue = l.valueOf, &valueIndex{keys: slices.Clone(l.byValue.keys)}
+	}
+	return c
+}
+
+// whether l and other have the same length, minKeep and capacity and the
+// same entries, items compared with itemEqual. as in Merge, other is copied
+// before l is locked so the two locks are never held together.
+func (l *History[T]) Equal(other *History[T], itemEqual func(a T, b T) bool) bool {
+	if other == l {
+		return true
+	}
+	other.rlock()
+	length, minKeep, capacity := other.length, other.minKeep, other.capacity
+	entries := other.entries()
+	other.mux.RUnlock()
+
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if l.length != length || l.minKeep != minKeep || l.capacity != capacity || len(l.times) != len(entries) {
+		return false
+	}
+	for i, t := range l.times {
+		if !t.Equal(entries[i].Time) || !itemEqual(l.t[t], entries[i].Item) {
+			return false
+		}
+	}
+	return true
+}
+
+// copies the entries of other into l and evicts as Add would. entries at
+// times already in l are skipped, as Add rejects them, and counted in the
+// returned ErrDuplicate. other is copied before l is locked so the two locks
+// are never held together, and merges in opposite directions can't deadlock.
+func (l *History[T]) Merge(other *History[T]) error {
+	if other == l {
+		return nil
+	}
+	entries := other.Snapshot()
+
+	l.mux.Lock()
+	defer l.unlock()
+
+	if err := l.consistent(); err != nil {
+		return err
+	}
+	return l.merge(entries)
+}
+
+// stores entries under a single lock, merging them into times in one pass
+// and evicting once at the end. the batch need not be sorted. as with Add,
+// an entry at a time already stored, or stored earlier in the batch, is
+// skipped. skipped entries are counted in the returned ErrDuplicate and the
+// rest are still stored.
+func (l *History[T]) AddBatch(entries []Entry[T]) error {
+	byTime := func(a Entry[T], b Entry[T]) int { return a.Time.Compare(b.Time) }
+	if !slices.IsSortedFunc(entries, byTime) {
+		entries = slices.Clone(entries)
+		slices.SortStableFunc(entries, byTime)
+	}
+
+	l.mux.Lock()
+	defer l.unlock()
+	if l.latencies != nil {
+		defer l.latencies.record("AddBatch", time.Now())
+	}
+
+	if err := l.consistent(); err != nil {
+		return err
+	}
+	return l.merge(entries)
+}
+
+// caller holds the lock. merges the sorted entries into times in one pass
+// skipping any already stored, then evicts.
+func (l *History[T]) merge(entries []Entry[T]) error {
+	dups := 0
+	times := make([]time.Time, 0, len(l.times)+len(entries))
+	i := 0
+	for _, e := range entries {
+		e.Time = l.stored(l.stamp(e.Time))
+		if _, ok := l.t[e.Time]; ok {
+			dups++
+			continue
+		}
+		for ; i < len(l.times) && !l.times[i].After(e.Time); i++ {
+			times = append(times, l.times[i])
+		}
+		times = append(times, e.Time)
+		l.put(e.Time, e.Item)
+		l.unroll(e.Time)
+		if l.observer != nil {
+			l.observer.ObserveAdd()
+		}
+	}
+	l.times = append(times, l.times[i:]...)
+	l.trimmed = 0
+	l.evict()
+
+	if dups > 0 {
+		l.warn("duplicate timestamps skipped", slog.Int("count", dups))
+		return fmt.Errorf("%w: %d times already stored", ErrDuplicate, dups)
+	}
+	return nil
+}
+
+// deletes the item stored at exactly t, reporting whether there was one
+func (l *History[T]) Remove(t time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	t = l.stored(key(t))
+	if _, ok := l.t[t]; !ok {
+		return false
+	}
+
+	i := l.indexOf(t)
+	l.times = slices.Delete(l.times, i, i+1)
+	l.del(t)
+	return true
+}
+
+// deletes all items older than cutoff regardless of length and minKeep,
+// returning how many were removed
+func (l *History[T]) RemoveBefore(cutoff time.Time) int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	n := indexAtOrAfter(l.times, cutoff)
+	for _, t := range l.times[:n] {
+		l.del(t)
+	}
+	l.times = l.times[n:]
+	l.trimmed += n
+	l.reslice()
+	return n
+}
+
+// same as RemoveBefore, named to go with TruncateToLast
+func (l *History[T]) TruncateOldestBefore(cutoff time.Time) int {
+	return l.RemoveBefore(cutoff)
+}
+
+// moves every item offset later, or earlier for a negative offset, for
+// replaying recorded data as if now or correcting a skewed import. TTL
+// deadlines move with their items. the order of the items is unchanged, so
+// eviction by length and capacity keeps the same items, but it is applied
+// again against the clock: a negative offset can expire items by TTL, and
+// with WithAutoTrim the next read trims those now older than length. it
+// rewrites every key, O(n), and is meant for data preparation and tests.
+func (l *History[T]) Shift(offset time.Duration) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	if offset == 0 {
+		return
+	}
+	for i, t := range l.times {
+		l.times[i] = t.Add(offset)
+	}
+	l.t = shiftKeys(l.t, offset)
+	l.weights = shiftKeys(l.weights, offset)
+	l.labels = shiftKeys(l.labels, offset)
+	l.seqs = shiftKeys(l.seqs, offset)
+	l.deadlines = shiftKeys(l.deadlines, offset)
+	for t, at := range l.deadlines {
+		l.deadlines[t] = at.Add(offset)
+	}
+	for i, d := range l.expiries {
+		l.expiries[i] = deadline{at: d.at.Add(offset), t: d.t.Add(offset)}
+	}
+	l.rekey()
+	clear(l.rolledTo)
+	l.reindex()
+	l.evict()
+}
+
+// copy of m with every key moved by offset, nil for nil
+func shiftKeys[V any](m map[time.Time]V, offset time.Duration) map[time.Time]V {
+	if m == nil {
+		return nil
+	}
+	shifted := make(map[time.Time]V, len(m))
+	for t, v := range m {
+		shifted[t.Add(offset)] = v
+	}
+	return shifted
+}
+
+// deletes all but the newest n items at once, returning how many were
+// removed. as the caller asks for it explicitly, minKeep does not apply and
+// n may be below it. a negative n is treated as 0.
+func (l *History[T]) TruncateToLast(n int) int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	cut := max(len(l.times)-max(n, 0), 0)
+	for _, t := range l.times[:cut] {
+		l.del(t)
+	}
+	l.times = l.times[cut:]
+	l.trimmed += cut
+	l.reslice()
+	return cut
+}
+
+// drops all items, keeping the configured length and minKeep
+func (l *History[T]) Clear() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.clear()
+}
+
+// all entries oldest first, dropping them as Clear does in the same step,
+// so an Add racing it lands either in the returned entries or in the
+// emptied History. onEvict is not called for them.
+func (l *History[T]) Drain() []Entry[T] {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	entries := l.entries()
+	l.clear()
+	return entries
+}
+
+// drops all items and sets a new length in one step
+func (l *History[T]) Reset(d time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.clear()
+	l.length = d
+}
+
+func (l *History[T]) clear() {
+	l.t = make(map[time.Time]T, l.initialCap)
+	l.times = make([]time.Time, 0, l.initialCap)
+	l.trimmed = 0
+	l.deadlines, l.expiries = nil, nil
+	l.weights = nil
+	l.labels = nil
+	l.seqs = nil
+	l.keys = nil
+	clear(l.rolledTo)
+	l.reindex()
+	var zero T
+	l.total = zero
+	if l.sketch != nil {
+		l.sketch.reset()
+	}
+}
+
+// caller holds the lock. stores it in the map, replacing any item at t,
+// and keeps the tracked total up to date. times is left to the caller.
+func (l *History[T]) put(t time.Time, it T) {
+	if l.sum != nil {
+		if old, ok := l.t[t]; ok {
+			l.total = l.sub(l.total, old)
+		}
+		l.total = l.sum(l.total, it)
+	}
+	if l.sketch != nil {
+		if old, ok := l.t[t]; ok {
+			l.sketch.remove(l.value(old))
+		}
+		l.sketch.add(l.value(it))
+	}
+	if l.byValue != nil {
+		if old, ok := l.t[t]; ok {
+			l.byValue.remove(l.valueOf(old), t)
+		}
+		l.byValue.add(l.valueOf(it), t)
+	}
+	if l.deadlines != nil {
+		delete(l.deadlines, t)
+	}
+	if l.weights != nil {
+		delete(l.weights, t)
+	}
+	if l.labels != nil {
+		delete(l.labels, t)
+	}
+	if l.seq {
+		l.number(t)
+	}
+	if l.timeKey != nil {
+		if l.keys == nil {
+			l.keys = make(map[int64]time.Time)
+		}
+		l.keys[l.timeKey(t)] = t
+	}
+	l.t[t] = it
+	if l.nsubs > 0 {
+		l.added = append(l.added, l.entryAt(t))
+	}
+}
+
+// caller holds the lock. gives the item at t the next Seq. after 2^64-1
+// items the count wraps round to 1, skipping the 0 that means no Seq.
+func (l *History[T]) number(t time.Time) {
+	if l.seqs == nil {
+		l.seqs = make(map[time.Time]uint64)
+	}
+	l.lastSeq++
+	if l.lastSeq == 0 {
+		l.lastSeq = 1
+	}
+	l.seqs[t] = l.lastSeq
+}
+
+// caller holds the lock. the entry stored at t, with its Seq
+func (l *History[T]) entryAt(t time.Time) Entry[T] {
+	return Entry[T]{Time: t, Item: l.t[t], Seq: l.seqs[t]}
+}
+
+// caller holds the lock. removes the item at t from the map and the
+// tracked total. times is left to the caller.
+func (l *History[T]) del(t time.Time) {
+	if l.sum != nil {
+		l.total = l.sub(l.total, l.t[t])
+	}
+	if l.sketch != nil {
+		l.sketch.remove(l.value(l.t[t]))
+	}
+	if l.byValue != nil {
+		l.byValue.remove(l.valueOf(l.t[t]), t)
+	}
+	if l.deadlines != nil {
+		delete(l.deadlines, t)
+	}
+	if l.weights != nil {
+		delete(l.weights, t)
+	}
+	if l.labels != nil {
+		delete(l.labels, t)
+	}
+	if l.seqs != nil {
+		delete(l.seqs, t)
+	}
+	if l.keys != nil {
+		delete(l.keys, l.timeKey(t))
+	}
+	delete(l.t, t)
+}
+
+// keeps a running total of the stored items, adding each stored item with
+// sum and taking each removed one off with sub, so that TrailingSum and
+// TrailingAvg are O(1). sub must undo sum exactly, which holds for integers
+// but only approximately for floats. the total starts from the items stored
+// now, nil sum stops tracking.
+func (l *History[T]) TrackSum(sum func(a T, b T) T, sub func(a T, b T) T) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.sum, l.sub = sum, sub
+	var zero T
+	l.total = zero
+	if sum != nil {
+		for _, t := range l.times {
+			l.total = sum(l.total, l.t[t])
+		}
+	}
+}
+
+// tracked total of all stored items, false if TrackSum was not called
+func (l *History[T]) TrailingSum() (T, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.total, l.sum != nil
+}
+
+// keeps a quantile sketch of value over the stored items for
+// ApproxPercentile, updated in O(1) as items are stored and removed, so
+// evicted items leave the sketch too. relErr outside (0, 1) is taken as
+// 0.01. the sketch starts from the items stored now, nil value stops
+// tracking.
+func (l *History[T]) TrackQuantiles(value func(it T) float64, relErr float64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if value == nil {
+		l.value, l.sketch = nil, nil
+		return
+	}
+	if !(relErr > 0 && relErr < 1) {
+		relErr = defaultRelErr
+	}
+	l.value, l.sketch = value, makeQuantileSketch(relErr)
+	for _, t := range l.times {
+		l.sketch.add(value(l.t[t]))
+	}
+}
+
+// approximate p-th percentile, 0 <= p <= 1, of all stored items. the
+// result is within relErr of the item PercentileBetween would pick over the
+// whole History, relative to that item's value: 1000 at 0.01 means
+// somewhere in [990, 1010]. NaN and infinite values are left out.
+// ErrNotTracked unless TrackQuantiles was called, ErrNoValues if empty.
+func (l *History[T]) ApproxPercentile(p float64) (float64, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if l.sketch == nil {
+		return 0, ErrNotTracked
+	}
+	if !(p >= 0 && p <= 1) {
+		return 0, fmt.Errorf("%w: %v", ErrPercentile, p)
+	}
+	if l.sketch.n == 0 {
+		return 0, ErrNoValues
+	}
+	return l.sketch.quantile(p), nil
+}
+
+// tracked total of all stored items divided by their count, in O(1).
+// ErrNotTracked unless TrackSum was called, ErrNoValues if empty.
+func (l *History[T]) TrailingAvg(div func(a T, n int) T) (T, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var zero T
+	if l.sum == nil {
+		return zero, ErrNotTracked
+	}
+	if len(l.times) == 0 {
+		return zero, ErrNoValues
+	}
+	return div(l.total, len(l.times)), nil
+}
+
+// index in times of a time stored in the map. equal instants can be
+// distinct map keys, so step over those to the exact key.
+func (l *History[T]) indexOf(t time.Time) int {
+	i := indexAtOrAfter(l.times, t)
+	for l.times[i] != t {
+		i++
+	}
+	return i
+}
+
+// item stored at exactly t, false if there is none. O(1). monotonic
+// readings are ignored as for Add, but an equal instant in another location
+// is a different key unless WithTimeKey maps them to one.
+func (l *History[T]) Get(t time.Time) (T, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("Get", time.Now())
+	}
+
+	it, ok := l.t[l.stored(key(t))]
+	return it, ok
+}
+
+// last item at or before given time and time it was logged. an item
+// stored at exactly wanted is returned, not the one before it. when wanted
+// precedes the oldest item, the oldest item and its time are returned
+// together with ErrBeforeStart, so a caller dropping the error gets a later
+// item than it asked for. BeforeStrict returns no item in that case.
+func (l *History[T]) Before(wanted time.Time) (T, time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("Before", time.Now())
+	}
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	return l.before(wanted)
+}
+
+// Before returning the zero value and time with ErrBeforeStart when wanted
+// precedes the oldest item, rather than the oldest item
+func (l *History[T]) BeforeStrict(wanted time.Time) (T, time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	it, then, err := l.before(wanted)
+	if err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+	return it, then, nil
+}
+
+// Before that also errors with ErrStale when the item found was logged
+// more than maxAge before wanted
+func (l *History[T]) BeforeWithin(wanted time.Time, maxAge time.Duration) (T, time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	it, then, err := l.before(wanted)
+	if err == nil && then.Before(wanted.Add(-maxAge)) {
+		err = fmt.Errorf("%w: logged %v before wanted time", ErrStale, wanted.Sub(then))
+	}
+	return it, then, err
+}
+
+// Before for each of wanted, which must be sorted ascending, found in one
+// merge pass over both in O(n+m) rather than by m binary searches. the
+// items and times line up with wanted. as with Before, a time before the
+// oldest item gets the oldest item, and the first such time is named in
+// the ErrBeforeStart returned with the full results.
+func (l *History[T]) BeforeBatch(wanted []time.Time) ([]T, []time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	if len(l.times) == 0 {
+		return nil, nil, ErrEmpty
+	}
+
+	var err error
+	items := make([]T, len(wanted))
+	times := make([]time.Time, len(wanted))
+	i := 0
+	for k, w := range wanted {
+		for i < len(l.times) && !l.times[i].After(w) {
+			i++
+		}
+		then := l.times[max(i-1, 0)]
+		if i == 0 && err == nil {
+			err = fmt.Errorf("%w: %v", ErrBeforeStart, w)
+		}
+		items[k], times[k] = l.t[then], then
+	}
+	return items, times, err
+}
+
+// Before that also returns how far before wanted the item was logged. with
+// ErrBeforeStart the gap is negative, the oldest item being after wanted,
+// and with ErrEmpty it is 0.
+func (l *History[T]) BeforeWithGap(wanted time.Time) (T, time.Time, time.Duration, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	it, then, err := l.before(wanted)
+	if errors.Is(err, ErrEmpty) {
+		return it, then, 0, err
+	}
+	return it, then, wanted.Sub(then), err
+}
+
+// caller holds the lock. reports how long the lookup begun at start took,
+// timed by the wall clock even where a Clock is set
+func (l *History[T]) observeLookup(start time.Time) {
+	l.observer.ObserveLookup(time.Since(start))
+}
+
+// caller holds the lock
+func (l *History[T]) before(wanted time.Time) (T, time.Time, error) {
+	if len(l.times) == 0 {
+		var zero T
+		return zero, l.clock.Now(), ErrEmpty
+	}
+
+	if wanted.Before(l.times[0]) {
+		return l.t[l.times[0]], l.times[0], ErrBeforeStart
+	}
+
+	then := binsearch(wanted, l.times)
+	return l.t[then], then, nil
+}
+
+// first item after given time and time it was logged
+func (l *History[T]) After(wanted time.Time) (T, time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("After", time.Now())
+	}
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	if len(l.times) == 0 {
+		var zero T
+		return zero, l.clock.Now(), ErrEmpty
+	}
+
+	i := indexAfter(l.times, wanted)
+	if i == len(l.times) {
+		last := l.times[len(l.times)-1]
+		return l.t[last], last, ErrAfterEnd
+	}
+
+	return l.t[l.times[i]], l.times[i], nil
 }
 
-func MakeHistory(d time.Duration) *History {
-	return &History{
-		length: d,
-		t:      make(map[time.Time]HistoryItem),
-		times:  make([]time.Time, 0),
+// item closest to given time and time it was logged, ties go to the earlier
+func (l *History[T]) Nearest(wanted time.Time) (T, time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("Nearest", time.Now())
+	}
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	if len(l.times) == 0 {
+		var zero T
+		return zero, l.clock.Now(), ErrEmpty
+	}
+
+	i := indexAfter(l.times, wanted)
+	if i == 0 {
+		return l.t[l.times[0]], l.times[0], nil
+	}
+
+	then := l.times[i-1]
+	if i < len(l.times) && l.times[i].Sub(wanted) < wanted.Sub(then) {
+		then = l.times[i]
 	}
+	return l.t[then], then, nil
 }
 
-func (l *History) UpdateDuration(d time.Duration) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// up to n entries closest to wanted, in time order, found by growing a
+// range outwards from wanted's place in times. as in Nearest, of two
+// entries equally far from wanted the earlier is taken first, so a tie for
+// the last place goes to the earlier one.
+func (l *History[T]) NearestN(wanted time.Time, n int) []Entry[T] {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	l.length = d
+	lo := indexAfter(l.times, wanted)
+	hi := lo
+	for hi-lo < n && (lo > 0 || hi < len(l.times)) {
+		if hi == len(l.times) || lo > 0 && wanted.Sub(l.times[lo-1]) <= l.times[hi].Sub(wanted) {
+			lo--
+		} else {
+			hi++
+		}
+	}
+	return l.entriesIn(lo, hi)
 }
 
-func (l *History) Len() int {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// oldest item and its time, false if the log is empty
+func (l *History[T]) Oldest() (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	return len(l.times)
+	if len(l.times) == 0 {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return l.t[l.times[0]], l.times[0], true
 }
 
-func (l *History) Add(t time.Time, it HistoryItem) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// newest item and its time, false if the log is empty
+func (l *History[T]) Newest() (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	l.times = append(l.times, t)
-	l.t[t] = it
+	if len(l.times) == 0 {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	last := l.times[len(l.times)-1]
+	return l.t[last], last, true
+}
 
-	if len(l.times) != len(l.t) {
-		err := fmt.Errorf("History in inconsistent state: %v %v", len(l.times), len(l.t))
-		panic(err)
+// entry at position index in time order, 0 the oldest, false if index is
+// out of range. positions hold only until the next write, as an Add or an
+// eviction shifts them.
+func (l *History[T]) At(index int) (Entry[T], bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if index < 0 || index >= len(l.times) {
+		return Entry[T]{}, false
 	}
+	return l.entryAt(l.times[index]), true
+}
 
-	lastTime := l.times[len(l.times)-1]
-	// remove older, keep at least 100
-	for len(l.times) > 100 && lastTime.Sub(l.times[0]) > l.length {
-		rem := l.times[0]
-		delete(l.t, rem)
-		l.times = l.times[1:]
+// position in time order of the item stored at exactly t, matched as Get
+// matches it, false if none is stored there
+func (l *History[T]) IndexOf(t time.Time) (int, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	t = l.stored(key(t))
+	if _, ok := l.t[t]; !ok {
+		return 0, false
 	}
+	return l.indexOf(t), true
 }
 
-// last item before given time and time it was logged
-func (l *History) Before(wanted time.Time) (HistoryItem, time.Time, error) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// how long before the clock's now the newest item was logged, false if
+// the log is empty. O(1).
+func (l *History[T]) Age() (time.Duration, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
 	if len(l.times) == 0 {
-		return nil, time.Now(), fmt.Errorf("empty log")
+		return 0, false
 	}
+	return l.clock.Now().Sub(l.times[len(l.times)-1]), true
+}
 
-	if wanted.Before(l.times[0]) {
-		return l.t[l.times[0]], l.times[0], fmt.Errorf("wanted time before log start")
+// whether the newest item was logged within maxAge of the clock's now,
+// false for an empty log
+func (l *History[T]) IsFresh(maxAge time.Duration) bool {
+	age, ok := l.Age()
+	return ok && age <= maxAge
+}
+
+// whether the items span a whole length, from the oldest to the newest,
+// so that averages and rates over length see a full window. a slow source
+// can be warm with few items. false with fewer than two items, and always
+// for a History without a length.
+func (l *History[T]) IsWarm() bool {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if l.length <= 0 || len(l.times) < 2 {
+		return false
 	}
+	return l.times[len(l.times)-1].Sub(l.times[0]) >= l.length
+}
 
-	then := binsearch(wanted, l.times)
-	return l.t[then], then, nil
+// oldest and newest times and the duration between them.
+// ok is false when there are fewer than two items, as the span is then zero.
+func (l *History[T]) Span() (oldest time.Time, newest time.Time, d time.Duration, ok bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return time.Time{}, time.Time{}, 0, false
+	}
+	oldest, newest = l.times[0], l.times[len(l.times)-1]
+	return oldest, newest, newest.Sub(oldest), len(l.times) > 1
+}
+
+// short summary for logs, without the entries: the count, and the span
+// and end times when not empty. Dump writes out the entries.
+func (l *History[T]) String() string {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return "History(len=0)"
+	}
+	oldest, newest := l.times[0], l.times[len(l.times)-1]
+	return fmt.Sprintf("History(len=%d, span=%v, oldest=%s, newest=%s)",
+		len(l.times), newest.Sub(oldest), oldest.Format(time.RFC3339Nano), newest.Format(time.RFC3339Nano))
+}
+
+// item at time t interpolated by lerp between the items around it, frac
+// being how far t is from a's time towards b's in [0, 1). outside the
+// logged range the nearest end is returned with ErrBeforeStart or ErrAfterEnd.
+func (l *History[T]) Interpolate(t time.Time, lerp func(a T, b T, frac float64) T) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.interpolate(t, lerp)
+}
+
+// caller holds the lock
+func (l *History[T]) interpolate(t time.Time, lerp func(a T, b T, frac float64) T) (T, error) {
+	if len(l.times) == 0 {
+		var zero T
+		return zero, ErrEmpty
+	}
+
+	i := indexAfter(l.times, t)
+	if i == 0 {
+		return l.t[l.times[0]], ErrBeforeStart
+	}
+	a := l.times[i-1]
+	if a.Equal(t) {
+		return l.t[a], nil
+	}
+	if i == len(l.times) {
+		return l.t[a], ErrAfterEnd
+	}
+
+	b := l.times[i]
+	return lerp(l.t[a], l.t[b], float64(t.Sub(a))/float64(b.Sub(a))), nil
 }
 
 func binsearchindex(wanted time.Time, times []time.Time, index int) int {
@@ -105,6 +1604,44 @@ func linsearchindex(wanted time.Time, times []time.Time, index int) int {
 	}
 }
 
+// index range [lo, hi) of the entries in the from, to window, found by
+// binary search as every window method finds it: the window is
+// Snapshot()[lo:hi], lo being the first entry in the window or where it
+// would go, and lo == hi if it is empty. the ends follow the bounds, so by
+// default an entry at from is in and one at to is out. the indexes hold
+// only until the next write, which can shift them, so they match a Snapshot
+// or a parallel slice only when nothing is added in between.
+func (l *History[T]) IndexBounds(from time.Time, to time.Time) (lo int, hi int) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.window(from, to)
+}
+
+// caller holds the lock. index range [lo, hi) of the times in the
+// from, to window under the configured bounds, lo == hi if it is empty.
+func (l *History[T]) window(from time.Time, to time.Time) (int, int) {
+	lo := indexAfter(l.times, from)
+	if l.bounds.includesFrom() {
+		lo = indexAtOrAfter(l.times, from)
+	}
+	hi := indexAtOrAfter(l.times, to)
+	if l.bounds.includesTo() {
+		hi = indexAfter(l.times, to)
+	}
+	return lo, max(hi, lo)
+}
+
+// index of the first time strictly after t, len(times) if none
+func indexAfter(times []time.Time, t time.Time) int {
+	return sort.Search(len(times), func(i int) bool { return times[i].After(t) })
+}
+
+// index of the first time at or after t, len(times) if none
+func indexAtOrAfter(times []time.Time, t time.Time) int {
+	return sort.Search(len(times), func(i int) bool { return !times[i].Before(t) })
+}
+
 func binsearch(wanted time.Time, times []time.Time) time.Time {
 	if len(times) <= 8 {
 		return linsearch(wanted, times)
@@ -133,75 +1670,618 @@ func linsearch(wanted time.Time, times []time.Time) time.Time {
 	return then
 }
 
-func (l *History) NumItemsBetween(start time.Time, end time.Time) (int, error) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// number of items in the start, end window. before WithBounds this was
+// (start, end), now [start, end) by default, so an item at start counts:
+// build the History WithBounds(Open) for the old count.
+func (l *History[T]) NumItemsBetween(start time.Time, end time.Time) (int, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
 	if len(l.times) == 0 {
-		return 0, fmt.Errorf("empty log")
+		return 0, ErrEmpty
 	}
 
-	startIndex := binsearchindex(start, l.times, 0)
-	endIndex := binsearchindex(end, l.times, 0)
-	count := 0
-	if l.times[startIndex] == start {
-		count = endIndex-startIndex-1
-	} else {
-		count = endIndex - startIndex
+	lo, hi := l.window(start, end)
+	return hi - lo, nil
+}
+
+// entries in the from, to window, oldest first.
+// the returned slice is a copy owned by the caller.
+func (l *History[T]) Range(from time.Time, to time.Time) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("Range", time.Now())
 	}
-	if count < 0 {
-		count = 0
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
 	}
-	return count, nil
+
+	lo, hi := l.window(from, to)
+	return l.entriesIn(lo, hi), nil
 }
 
-func (l *History) ItemsBetween(start time.Time, end time.Time) ([]HistoryItemWithTime, error) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// Range into dst's memory: the entries overwrite dst from its start and
+// the result is dst grown as needed, so a hot path passing back the last
+// result allocates only when a window outgrows it
+func (l *History[T]) RangeInto(dst []Entry[T], from time.Time, to time.Time) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return dst[:0], ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	dst = dst[:0]
+	for _, t := range l.times[lo:hi] {
+		dst = append(dst, l.entryAt(t))
+	}
+	return dst, nil
+}
 
-	its := make([]HistoryItemWithTime, 0)
+// calls fn on the items in the from, to window, oldest first, until fn
+// returns false. the lock is held throughout so fn sees a consistent state,
+// which also means fn must not call back into the History or it will deadlock.
+func (l *History[T]) ForEach(from time.Time, to time.Time, fn func(t time.Time, it T) bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	startIndex := binsearchindex(start, l.times, 0)
-	endIndex := binsearchindex(end, l.times, 0)
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		if !fn(l.times[i], l.t[l.times[i]]) {
+			return
+		}
+	}
+}
+
+// page of up to limit entries in the from, to window strictly after
+// afterTime, oldest first, and the cursor to pass as afterTime for the next
+// page: the last time returned, or afterTime if none were. pass the zero
+// time for the first page. a page shorter than limit is the last, and a
+// limit of 0 or less returns the rest of the window. each page is found by
+// binary search, so Adds between pages show up in later pages if they fall
+// after the cursor and never repeat those already returned, while items
+// evicted in between are simply gone.
+func (l *History[T]) RangePage(from time.Time, to time.Time, afterTime time.Time, limit int) ([]Entry[T], time.Time, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, afterTime, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	lo = max(lo, indexAfter(l.times, afterTime))
+	if limit > 0 {
+		hi = min(hi, lo+limit)
+	}
+	if lo >= hi {
+		return []Entry[T]{}, afterTime, nil
+	}
+	return l.entriesIn(lo, hi), l.times[hi-1], nil
+}
+
+// calls fn with successive chunks of up to size entries of the from, to
+// window, oldest first, stopping with the first error fn returns. the end
+// of the window is fixed at the first chunk, then each chunk is copied under
+// its own read lock and fn runs outside the lock, so it may call back into
+// the History, and entries added meanwhile inside the rest of the window are
+// included while those evicted are not. each chunk is owned by fn.
+// ErrEmpty for an empty log, ErrInterval for a size that is not positive.
+func (l *History[T]) Chunks(from time.Time, to time.Time, size int, fn func(chunk []Entry[T]) error) error {
+	if size <= 0 {
+		return fmt.Errorf("%w: chunk size %d", ErrInterval, size)
+	}
 
-	if l.times[startIndex] == start {
-		startIndex += 1
+	l.rlock()
+	if len(l.times) == 0 {
+		l.mux.RUnlock()
+		return ErrEmpty
 	}
-	
-	for i:= startIndex; i<=endIndex; i++ {
-		its = append(its, HistoryItemWithTime{Time: l.times[i], Item: l.t[l.times[i]]})
+	lo, hi := l.window(from, to)
+	if lo == hi {
+		l.mux.RUnlock()
+		return nil
+	}
+	last := l.times[hi-1]
+	chunk := l.entriesIn(lo, min(lo+size, hi))
+	l.mux.RUnlock()
+
+	for len(chunk) > 0 {
+		if err := fn(chunk); err != nil {
+			return err
+		}
+		after := chunk[len(chunk)-1].Time
+		if !after.Before(last) {
+			return nil
+		}
+
+		l.rlock()
+		lo, hi := indexAfter(l.times, after), indexAfter(l.times, last)
+		chunk = l.entriesIn(lo, max(min(lo+size, hi), lo))
+		l.mux.RUnlock()
 	}
+	return nil
+}
 
-	return its, nil
+// entries in the from, to window, newest first, selected as Range does
+func (l *History[T]) RangeDesc(from time.Time, to time.Time) ([]Entry[T], error) {
+	entries, err := l.Range(from, to)
+	slices.Reverse(entries)
+	return entries, err
 }
 
-func (l *History) AvgBetween(
-	from time.Time,
-	to time.Time,
-	zero HistoryItem,
-	sum func(a HistoryItem, b HistoryItem) HistoryItem,
-	div func(a HistoryItem, n int) HistoryItem,
-) (HistoryItem, error) {
-	l.mux.Lock()
-	defer l.mux.Unlock()
+// ForEach walking the window newest first
+func (l *History[T]) ForEachDesc(from time.Time, to time.Time, fn func(t time.Time, it T) bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	cum := zero
-	count := 0
-	// TODO binary search
+	lo, hi := l.window(from, to)
+	for i := hi - 1; i >= lo; i-- {
+		if !fn(l.times[i], l.t[l.times[i]]) {
+			return
+		}
+	}
+}
+
+// oldest item in the from, to window matching pred and its time, false if
+// none does. the scan stops at the first match.
+func (l *History[T]) FindFirst(from time.Time, to time.Time, pred func(it T) bool) (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		if it := l.t[l.times[i]]; pred(it) {
+			return it, l.times[i], true
+		}
+	}
+	var zero T
+	return zero, time.Time{}, false
+}
+
+// newest item in the from, to window matching pred and its time, scanning
+// back from to
+func (l *History[T]) FindLast(from time.Time, to time.Time, pred func(it T) bool) (T, time.Time, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for i := hi - 1; i >= lo; i-- {
+		if it := l.t[l.times[i]]; pred(it) {
+			return it, l.times[i], true
+		}
+	}
+	var zero T
+	return zero, time.Time{}, false
+}
+
+// all entries oldest first, taken atomically. the slice is owned by the
+// caller and later changes to the History do not show in it, though items
+// holding pointers still share what they point to.
+func (l *History[T]) Snapshot() []Entry[T] {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.entries()
+}
+
+// entries stored now that are not in prev, an earlier Snapshot, and those
+// of prev no longer stored, both oldest first, for sending only what
+// changed. entries are matched by time, and with WithSeq by Seq too, so an
+// item replaced since shows as removed and added; without WithSeq a
+// replacement goes unseen. one merge pass, O(n) in the larger of prev and
+// the History, which assumes prev is sorted by time as Snapshot gives it.
+func (l *History[T]) DiffSince(prev []Entry[T]) (added []Entry[T], removed []Entry[T]) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	i := 0
 	for _, t := range l.times {
-		if t.After(from) {
-			if t.Before(to) {
-				cum = sum(cum, l.t[t])
-				count++
-			} else {
-				break
+		for ; i < len(prev) && prev[i].Time.Before(t); i++ {
+			removed = append(removed, prev[i])
+		}
+		e := l.entryAt(t)
+		if i < len(prev) && prev[i].Time.Equal(t) {
+			if prev[i].Seq == e.Seq {
+				i++
+				continue
 			}
+			removed = append(removed, prev[i])
+			i++
+		}
+		added = append(added, e)
+	}
+	return added, append(removed, prev[i:]...)
+}
+
+// copy of the newest n entries, oldest first, fewer if there are not n
+func (l *History[T]) Tail(n int) []Entry[T] {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.entriesIn(max(len(l.times)-max(n, 0), 0), len(l.times))
+}
+
+// copy of the oldest n entries, oldest first, fewer if there are not n
+func (l *History[T]) Head(n int) []Entry[T] {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	return l.entriesIn(0, min(max(n, 0), len(l.times)))
+}
+
+// caller holds the lock
+func (l *History[T]) entries() []Entry[T] {
+	return l.entriesIn(0, len(l.times))
+}
+
+// caller holds the lock. copy of the entries at indexes [lo, hi) of times
+func (l *History[T]) entriesIn(lo int, hi int) []Entry[T] {
+	entries := make([]Entry[T], hi-lo)
+	for i, t := range l.times[lo:hi] {
+		entries[i] = l.entryAt(t)
+	}
+	return entries
+}
+
+// entries in the start, end window, oldest first. same as Range except
+// that an empty log gives an empty slice rather than an error. before
+// WithBounds this was about (start, end], sometimes with one item past
+// end, and it now follows the bounds: WithBounds(OpenClosed) is closest
+// to the old behaviour.
+func (l *History[T]) ItemsBetween(start time.Time, end time.Time) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(start, end)
+	return l.entriesIn(lo, hi), nil
+}
+
+// times and valueOf of the items in the from, to window as parallel
+// slices, oldest first, for charting and numeric code. both are freshly
+// allocated copies owned by the caller. ErrEmpty for an empty log, as Range.
+func (l *History[T]) ExportFloats(from time.Time, to time.Time, valueOf func(it T) float64) (ts []time.Time, vs []float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, nil, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	ts = slices.Clone(l.times[lo:hi])
+	vs = make([]float64, len(ts))
+	for i, t := range ts {
+		vs[i] = valueOf(l.t[t])
+	}
+	return ts, vs, nil
+}
+
+// a point for plotting, X being the time as seconds since the Unix epoch
+type XY struct {
+	X float64
+	Y float64
+}
+
+// the items in the from, to window as points, oldest first, y giving each
+// point's Y. the layout of gonum's plotter.XYs without depending on gonum,
+// see the gonumhistory package to convert. ErrEmpty for an empty log.
+func (l *History[T]) XYs(from time.Time, to time.Time, y func(it T) float64) (_ []XY, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	xys := make([]XY, 0, hi-lo)
+	for _, t := range l.times[lo:hi] {
+		xys = append(xys, XY{X: float64(t.UnixNano()) / 1e9, Y: y(l.t[t])})
+	}
+	return xys, nil
+}
+
+// average of items in the from, to window, summed starting from the zero
+// value of T. a window of one item averages to div of that item and 1.
+// under the default [from, to) bounds an item at from counts and one at to
+// does not, so from == to is always an empty window with ErrNoValues, even
+// at an item. WithBounds(Closed) counts both ends, making from == to the
+// window of the item stored at that time, if any. before WithBounds the
+// window was (from, to), so upgrading callers that relied on an item at
+// from being left out should build the History WithBounds(Open).
+func (l *History[T]) AvgBetween(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, error) {
+	return l.AvgBetweenCtx(context.Background(), from, to, sum, div)
+}
+
+// AvgBetween that gives up with ctx's error once ctx is done, checked every
+// ctxCheckEvery items so a cancelled scan releases the lock promptly, or
+// with ErrLockTimeout if ctx is done before the read lock can be had
+func (l *History[T]) AvgBetweenCtx(
+	ctx context.Context,
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (_ T, err error) {
+	defer l.catch(&err)
+	if err := l.rlockCtx(ctx); err != nil {
+		var zero T
+		return zero, err
+	}
+	defer l.mux.RUnlock()
+	if l.latencies != nil {
+		defer l.latencies.record("AvgBetween", time.Now())
+	}
+
+	return l.avgBetween(ctx, from, to, sum, div)
+}
+
+// caller holds the lock
+func (l *History[T]) avgBetween(
+	ctx context.Context,
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, error) {
+	var zero T
+	lo, hi := l.window(from, to)
+	cum, err := fold(ctx, l, lo, hi, zero, func(cum T, _ time.Time, it T) T { return sum(cum, it) })
+	if err != nil {
+		return zero, err
+	}
+
+	if lo == hi {
+		return zero, ErrNoValues
+	}
+
+	return div(cum, hi-lo), nil
+}
+
+// AvgBetween giving fallback and a nil error for an empty window rather
+// than ErrNoValues, for callers that treat no data as a known value
+func (l *History[T]) AvgBetweenOr(
+	from time.Time,
+	to time.Time,
+	fallback T,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, error) {
+	avg, err := l.AvgBetween(from, to, sum, div)
+	if errors.Is(err, ErrNoValues) {
+		return fallback, nil
+	}
+	return avg, err
+}
+
+// AvgBetween that also returns the entries it averaged, oldest first, to
+// explain a result or check the bounds. the entries are collected under the
+// same lock as the average, so they are exactly those folded in, at the
+// cost of a copy of the window that AvgBetween doesn't make.
+func (l *History[T]) AvgBetweenWithProvenance(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (_ T, _ []Entry[T], err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	avg, err := l.avgBetween(context.Background(), from, to, sum, div)
+	lo, hi := l.window(from, to)
+	return avg, l.entriesIn(lo, hi), err
+}
+
+// AvgBetween over the trailing window from the clock's now minus d to now,
+// with now read once under the lock
+func (l *History[T]) AvgSince(d time.Duration, sum func(a T, b T) T, div func(a T, n int) T) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	now := l.clock.Now()
+	return l.avgBetween(context.Background(), now.Add(-d), now, sum, div)
+}
+
+// averages over the trailing window from now - recent to now and over the
+// same window offset earlier, both measured from one now read under the
+// lock. ErrNoValues if either window is empty.
+func (l *History[T]) CompareWindows(
+	recent time.Duration,
+	offset time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (current T, previous T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	now := l.clock.Now()
+	current, err = l.avgBetween(context.Background(), now.Add(-recent), now, sum, div)
+	if err != nil {
+		return current, previous, fmt.Errorf("current window: %w", err)
+	}
+	then := now.Add(-offset)
+	previous, err = l.avgBetween(context.Background(), then.Add(-recent), then, sum, div)
+	if err != nil {
+		return current, previous, fmt.Errorf("previous window: %w", err)
+	}
+	return current, previous, nil
+}
+
+// CompareWindows for a seasonal lag, such as the same hour a day or a week
+// ago: averages over the trailing window ending now and the one ending ago
+// earlier, with the ratio of valueOf of the two, current over past.
+// ErrBeforeStart if the past window ends before the oldest item retained,
+// so that no data is left to compare with, and ErrNoValues if either window
+// is empty. the ratio is a plain float division: a past value of 0 gives
+// +Inf or -Inf, or NaN if the current value is 0 too, with a nil error, so
+// check math.IsInf and math.IsNaN where the past can average to 0.
+func (l *History[T]) CompareToPast(
+	window time.Duration,
+	ago time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	valueOf func(it T) float64,
+) (current T, past T, ratio float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return current, past, 0, ErrEmpty
+	}
+	now := l.clock.Now()
+	then := now.Add(-ago)
+	if then.Before(l.times[0]) {
+		return current, past, 0, fmt.Errorf("%w: past window ends at %v", ErrBeforeStart, then)
+	}
+
+	current, err = l.avgBetween(context.Background(), now.Add(-window), now, sum, div)
+	if err != nil {
+		return current, past, 0, fmt.Errorf("current window: %w", err)
+	}
+	past, err = l.avgBetween(context.Background(), then.Add(-window), then, sum, div)
+	if err != nil {
+		return current, past, 0, fmt.Errorf("past window: %w", err)
+	}
+	return current, past, valueOf(current) / valueOf(past), nil
+}
+
+// NumItemsBetween over the trailing window from now minus d to now
+func (l *History[T]) CountSince(d time.Duration) (int, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return 0, ErrEmpty
+	}
+
+	now := l.clock.Now()
+	lo, hi := l.window(now.Add(-d), now)
+	return hi - lo, nil
+}
+
+// items added per second over the trailing window from now minus d to now,
+// counted as CountSince counts them. a History younger than d is measured
+// from its oldest item instead, which marks the start and is not counted.
+// ErrEmpty for an empty log, ErrTooFew with fewer than two items to measure
+// between.
+func (l *History[T]) AddRate(d time.Duration) (float64, error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return 0, ErrEmpty
+	}
+	if len(l.times) < 2 {
+		return 0, ErrTooFew
+	}
+
+	now := l.clock.Now()
+	from := now.Add(-d)
+	lo, hi := l.window(from, now)
+	n := hi - lo
+	if oldest := l.times[0]; oldest.After(from) {
+		from = oldest
+		if lo == 0 {
+			n--
 		}
 	}
+	span := now.Sub(from)
+	if span <= 0 {
+		return 0, ErrTooFew
+	}
+	return float64(n) / span.Seconds(), nil
+}
+
+// Range over the trailing window from now minus d to now
+func (l *History[T]) RangeSince(d time.Duration) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	now := l.clock.Now()
+	lo, hi := l.window(now.Add(-d), now)
+	return l.entriesIn(lo, hi), nil
+}
+
+// folds the items in the from, to window seeded from the first of them
+// rather than a zero value: acc gets the running value, the next item and
+// its position in the window, starting at 1. finalize turns the result and
+// the item count into the answer, so min or max style folds can just return
+// running. ErrNoValues for an empty window.
+func (l *History[T]) AvgBetweenFold(
+	from time.Time,
+	to time.Time,
+	acc func(running T, next T, i int) T,
+	finalize func(running T, count int) T,
+) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if lo >= hi {
+		var zero T
+		return zero, ErrNoValues
+	}
+
+	running := l.t[l.times[lo]]
+	for i := lo + 1; i < hi; i++ {
+		running = acc(running, l.t[l.times[i]], i-lo)
+	}
+	return finalize(running, hi-lo), nil
+}
+
+// rough estimate of the memory held: the times slice by capacity plus the
+// map, whose slots hold a time, an item and a control byte at up to 7/8 load.
+// items count as T's size unless WithItemSize was given. O(1).
+func (l *History[T]) ApproxBytes() int {
+	l.rlock()
+	defer l.mux.RUnlock()
 
-	if count == 0 {
-		return 0, fmt.Errorf("timed log: no values to avg")
+	return l.approxBytes()
+}
+
+// caller holds the lock
+func (l *History[T]) approxBytes() int {
+	return cap(l.times)*timeSize + len(l.t)*l.slotBytes()
+}
+
+var timeSize = int(unsafe.Sizeof(time.Time{}))
+
+// bytes per map entry as ApproxBytes counts them
+func (l *History[T]) slotBytes() int {
+	return slotSize(l.itemBytes())
+}
+
+// bytes per item as ApproxBytes counts them, the size of T by default
+func (l *History[T]) itemBytes() int {
+	if l.itemSize == 0 {
+		var zero T
+		return int(unsafe.Sizeof(zero))
 	}
+	return l.itemSize
+}
 
-	return div(cum, count), nil
+// bytes per map entry for items of itemSize: key, item and a control byte,
+// at the map's 7/8 load factor
+func slotSize(itemSize int) int {
+	return (timeSize + itemSize + 1) * 8 / 7
 }
@@ -0,0 +1,515 @@
+package history
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// read-only access to a History. it shares the History's data and locks,
+// so it sees later Adds, but offers no way to change them.
+type HistoryView[T any] struct {
+	h *History[T]
+}
+
+// view of l exposing only its query methods
+func (l *History[T]) ReadOnly() *HistoryView[T] {
+	return &HistoryView[T]{h: l}
+}
+
+func (v *HistoryView[T]) Len() int {
+	return v.h.Len()
+}
+
+func (v *HistoryView[T]) Get(t time.Time) (T, bool) {
+	return v.h.Get(t)
+}
+
+func (v *HistoryView[T]) Before(wanted time.Time) (T, time.Time, error) {
+	return v.h.Before(wanted)
+}
+
+func (v *HistoryView[T]) BeforeStrict(wanted time.Time) (T, time.Time, error) {
+	return v.h.BeforeStrict(wanted)
+}
+
+func (v *HistoryView[T]) BeforeCtx(ctx context.Context, wanted time.Time) (T, time.Time, error) {
+	return v.h.BeforeCtx(ctx, wanted)
+}
+
+func (v *HistoryView[T]) BeforeBatch(wanted []time.Time) ([]T, []time.Time, error) {
+	return v.h.BeforeBatch(wanted)
+}
+
+func (v *HistoryView[T]) BeforeWithin(wanted time.Time, maxAge time.Duration) (T, time.Time, error) {
+	return v.h.BeforeWithin(wanted, maxAge)
+}
+
+func (v *HistoryView[T]) BeforeWithGap(wanted time.Time) (T, time.Time, time.Duration, error) {
+	return v.h.BeforeWithGap(wanted)
+}
+
+func (v *HistoryView[T]) After(wanted time.Time) (T, time.Time, error) {
+	return v.h.After(wanted)
+}
+
+func (v *HistoryView[T]) Nearest(wanted time.Time) (T, time.Time, error) {
+	return v.h.Nearest(wanted)
+}
+
+func (v *HistoryView[T]) NearestN(wanted time.Time, n int) []Entry[T] {
+	return v.h.NearestN(wanted, n)
+}
+
+func (v *HistoryView[T]) Oldest() (T, time.Time, bool) {
+	return v.h.Oldest()
+}
+
+func (v *HistoryView[T]) Newest() (T, time.Time, bool) {
+	return v.h.Newest()
+}
+
+func (v *HistoryView[T]) At(index int) (Entry[T], bool) {
+	return v.h.At(index)
+}
+
+func (v *HistoryView[T]) IndexOf(t time.Time) (int, bool) {
+	return v.h.IndexOf(t)
+}
+
+func (v *HistoryView[T]) Age() (time.Duration, bool) {
+	return v.h.Age()
+}
+
+func (v *HistoryView[T]) IsFresh(maxAge time.Duration) bool {
+	return v.h.IsFresh(maxAge)
+}
+
+func (v *HistoryView[T]) IsWarm() bool {
+	return v.h.IsWarm()
+}
+
+func (v *HistoryView[T]) Span() (oldest time.Time, newest time.Time, d time.Duration, ok bool) {
+	return v.h.Span()
+}
+
+func (v *HistoryView[T]) Interpolate(t time.Time, lerp func(a T, b T, frac float64) T) (T, error) {
+	return v.h.Interpolate(t, lerp)
+}
+
+func (v *HistoryView[T]) NumItemsBetween(start time.Time, end time.Time) (int, error) {
+	return v.h.NumItemsBetween(start, end)
+}
+
+func (v *HistoryView[T]) IndexBounds(from time.Time, to time.Time) (int, int) {
+	return v.h.IndexBounds(from, to)
+}
+
+func (v *HistoryView[T]) Range(from time.Time, to time.Time) ([]Entry[T], error) {
+	return v.h.Range(from, to)
+}
+
+func (v *HistoryView[T]) RangeAll(from time.Time, to time.Time) ([]Entry[T], error) {
+	return v.h.RangeAll(from, to)
+}
+
+func (v *HistoryView[T]) Chunks(from time.Time, to time.Time, size int, fn func(chunk []Entry[T]) error) error {
+	return v.h.Chunks(from, to, size, fn)
+}
+
+func (v *HistoryView[T]) RangeInto(dst []Entry[T], from time.Time, to time.Time) ([]Entry[T], error) {
+	return v.h.RangeInto(dst, from, to)
+}
+
+func (v *HistoryView[T]) RangeCtx(ctx context.Context, from time.Time, to time.Time) ([]Entry[T], error) {
+	return v.h.RangeCtx(ctx, from, to)
+}
+
+func (v *HistoryView[T]) ItemsBetween(start time.Time, end time.Time) ([]Entry[T], error) {
+	return v.h.ItemsBetween(start, end)
+}
+
+func (v *HistoryView[T]) ExportFloats(from time.Time, to time.Time, valueOf func(it T) float64) ([]time.Time, []float64, error) {
+	return v.h.ExportFloats(from, to, valueOf)
+}
+
+func (v *HistoryView[T]) XYs(from time.Time, to time.Time, y func(it T) float64) ([]XY, error) {
+	return v.h.XYs(from, to, y)
+}
+
+func (v *HistoryView[T]) ForEach(from time.Time, to time.Time, fn func(t time.Time, it T) bool) {
+	v.h.ForEach(from, to, fn)
+}
+
+func (v *HistoryView[T]) RangePage(from time.Time, to time.Time, afterTime time.Time, limit int) ([]Entry[T], time.Time, error) {
+	return v.h.RangePage(from, to, afterTime, limit)
+}
+
+func (v *HistoryView[T]) RangeDesc(from time.Time, to time.Time) ([]Entry[T], error) {
+	return v.h.RangeDesc(from, to)
+}
+
+func (v *HistoryView[T]) ForEachDesc(from time.Time, to time.Time, fn func(t time.Time, it T) bool) {
+	v.h.ForEachDesc(from, to, fn)
+}
+
+func (v *HistoryView[T]) FindFirst(from time.Time, to time.Time, pred func(it T) bool) (T, time.Time, bool) {
+	return v.h.FindFirst(from, to, pred)
+}
+
+func (v *HistoryView[T]) FindLast(from time.Time, to time.Time, pred func(it T) bool) (T, time.Time, bool) {
+	return v.h.FindLast(from, to, pred)
+}
+
+func (v *HistoryView[T]) Snapshot() []Entry[T] {
+	return v.h.Snapshot()
+}
+
+func (v *HistoryView[T]) DiffSince(prev []Entry[T]) ([]Entry[T], []Entry[T]) {
+	return v.h.DiffSince(prev)
+}
+
+func (v *HistoryView[T]) Tail(n int) []Entry[T] {
+	return v.h.Tail(n)
+}
+
+func (v *HistoryView[T]) Head(n int) []Entry[T] {
+	return v.h.Head(n)
+}
+
+func (v *HistoryView[T]) AvgBetween(from time.Time, to time.Time, sum func(a T, b T) T, div func(a T, n int) T) (T, error) {
+	return v.h.AvgBetween(from, to, sum, div)
+}
+
+func (v *HistoryView[T]) AvgBetweenOr(
+	from time.Time,
+	to time.Time,
+	fallback T,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, error) {
+	return v.h.AvgBetweenOr(from, to, fallback, sum, div)
+}
+
+func (v *HistoryView[T]) AvgBetweenWithProvenance(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, []Entry[T], error) {
+	return v.h.AvgBetweenWithProvenance(from, to, sum, div)
+}
+
+func (v *HistoryView[T]) AvgBetweenCtx(ctx context.Context, from time.Time, to time.Time, sum func(a T, b T) T, div func(a T, n int) T) (T, error) {
+	return v.h.AvgBetweenCtx(ctx, from, to, sum, div)
+}
+
+func (v *HistoryView[T]) AvgBetweenFold(from time.Time, to time.Time, acc func(running T, next T, i int) T, finalize func(running T, count int) T) (T, error) {
+	return v.h.AvgBetweenFold(from, to, acc, finalize)
+}
+
+func (v *HistoryView[T]) AvgSince(d time.Duration, sum func(a T, b T) T, div func(a T, n int) T) (T, error) {
+	return v.h.AvgSince(d, sum, div)
+}
+
+func (v *HistoryView[T]) CountSince(d time.Duration) (int, error) {
+	return v.h.CountSince(d)
+}
+
+func (v *HistoryView[T]) AddRate(d time.Duration) (float64, error) {
+	return v.h.AddRate(d)
+}
+
+func (v *HistoryView[T]) RangeSince(d time.Duration) ([]Entry[T], error) {
+	return v.h.RangeSince(d)
+}
+
+func (v *HistoryView[T]) CompareWindows(
+	recent time.Duration,
+	offset time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (current T, previous T, err error) {
+	return v.h.CompareWindows(recent, offset, sum, div)
+}
+
+func (v *HistoryView[T]) CompareToPast(
+	window time.Duration,
+	ago time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	valueOf func(it T) float64,
+) (T, T, float64, error) {
+	return v.h.CompareToPast(window, ago, sum, div, valueOf)
+}
+
+func (v *HistoryView[T]) SumBetween(from time.Time, to time.Time, sum func(a T, b T) T) (T, error) {
+	return v.h.SumBetween(from, to, sum)
+}
+
+func (v *HistoryView[T]) CountBetween(from time.Time, to time.Time) (int, error) {
+	return v.h.CountBetween(from, to)
+}
+
+func (v *HistoryView[T]) DistinctCountBetween(from time.Time, to time.Time, key func(it T) string) (int, error) {
+	return v.h.DistinctCountBetween(from, to, key)
+}
+
+func (v *HistoryView[T]) MinBetween(from time.Time, to time.Time, less func(a T, b T) bool) (T, time.Time, error) {
+	return v.h.MinBetween(from, to, less)
+}
+
+func (v *HistoryView[T]) MaxBetween(from time.Time, to time.Time, less func(a T, b T) bool) (T, time.Time, error) {
+	return v.h.MaxBetween(from, to, less)
+}
+
+func (v *HistoryView[T]) SumBetweenAuto(from time.Time, to time.Time) (T, error) {
+	return v.h.SumBetweenAuto(from, to)
+}
+
+func (v *HistoryView[T]) AvgBetweenAuto(from time.Time, to time.Time) (T, error) {
+	return v.h.AvgBetweenAuto(from, to)
+}
+
+func (v *HistoryView[T]) MinBetweenAuto(from time.Time, to time.Time) (T, time.Time, error) {
+	return v.h.MinBetweenAuto(from, to)
+}
+
+func (v *HistoryView[T]) MaxBetweenAuto(from time.Time, to time.Time) (T, time.Time, error) {
+	return v.h.MaxBetweenAuto(from, to)
+}
+
+func (v *HistoryView[T]) Sample(from time.Time, to time.Time, k int, rng *rand.Rand) ([]Entry[T], error) {
+	return v.h.Sample(from, to, k, rng)
+}
+
+func (v *HistoryView[T]) FirstExceeding(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) (T, time.Time, bool) {
+	return v.h.FirstExceeding(from, to, threshold, valueOf)
+}
+
+func (v *HistoryView[T]) LastBelow(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) (T, time.Time, bool) {
+	return v.h.LastBelow(from, to, threshold, valueOf)
+}
+
+func (v *HistoryView[T]) Crossings(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) ([]time.Time, error) {
+	return v.h.Crossings(from, to, threshold, valueOf)
+}
+
+func (v *HistoryView[T]) DirectedCrossings(from time.Time, to time.Time, threshold float64, valueOf func(it T) float64) ([]Crossing, error) {
+	return v.h.DirectedCrossings(from, to, threshold, valueOf)
+}
+
+func (v *HistoryView[T]) WeightedAvgBetween(from time.Time, to time.Time, valueOf func(it T) float64) (float64, error) {
+	return v.h.WeightedAvgBetween(from, to, valueOf)
+}
+
+func (v *HistoryView[T]) Gaps(from time.Time, to time.Time, minGap time.Duration) ([]Gap, error) {
+	return v.h.Gaps(from, to, minGap)
+}
+
+func (v *HistoryView[T]) VarianceBetween(from time.Time, to time.Time, valueOf func(it T) float64) (float64, float64, int, error) {
+	return v.h.VarianceBetween(from, to, valueOf)
+}
+
+func (v *HistoryView[T]) EWMA(from time.Time, to time.Time, halfLife time.Duration, valueOf func(it T) float64) (float64, error) {
+	return v.h.EWMA(from, to, halfLife, valueOf)
+}
+
+func (v *HistoryView[T]) Labels(t time.Time) (map[string]string, bool) {
+	return v.h.Labels(t)
+}
+
+func (v *HistoryView[T]) RangeMatching(from time.Time, to time.Time, match func(labels map[string]string) bool) ([]Entry[T], error) {
+	return v.h.RangeMatching(from, to, match)
+}
+
+func (v *HistoryView[T]) AvgBetweenMatching(
+	from time.Time,
+	to time.Time,
+	match func(labels map[string]string) bool,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (T, error) {
+	return v.h.AvgBetweenMatching(from, to, match, sum, div)
+}
+
+func (v *HistoryView[T]) WindowStats(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	less func(a T, b T) bool,
+	div func(a T, n int) T,
+) (Stats[T], error) {
+	return v.h.WindowStats(from, to, sum, less, div)
+}
+
+func (v *HistoryView[T]) ModeBetween(from time.Time, to time.Time, key func(it T) string) (T, int, error) {
+	return v.h.ModeBetween(from, to, key)
+}
+
+func (v *HistoryView[T]) GroupBy(from time.Time, to time.Time, key func(it T) string) (map[string][]Entry[T], error) {
+	return v.h.GroupBy(from, to, key)
+}
+
+func (v *HistoryView[T]) PercentileBetween(from time.Time, to time.Time, p float64, less func(a T, b T) bool) (T, error) {
+	return v.h.PercentileBetween(from, to, p, less)
+}
+
+func (v *HistoryView[T]) PercentileIntoBuf(buf []T, from time.Time, to time.Time, p float64, less func(a T, b T) bool) (T, []T, error) {
+	return v.h.PercentileIntoBuf(buf, from, to, p, less)
+}
+
+func (v *HistoryView[T]) HistogramBetween(from time.Time, to time.Time, bucketIndex func(it T) int, numBuckets int) ([]int, error) {
+	return v.h.HistogramBetween(from, to, bucketIndex, numBuckets)
+}
+
+func (v *HistoryView[T]) TimeWeightedAvgBetween(
+	from time.Time,
+	to time.Time,
+	scale func(it T, d time.Duration) T,
+	sum func(a T, b T) T,
+	div func(a T, d time.Duration) T,
+) (T, error) {
+	return v.h.TimeWeightedAvgBetween(from, to, scale, sum, div)
+}
+
+func (v *HistoryView[T]) IntegrateBetween(from time.Time, to time.Time, valueOf func(it T) float64) (float64, error) {
+	return v.h.IntegrateBetween(from, to, valueOf)
+}
+
+func (v *HistoryView[T]) Bucket(
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	keepEmpty bool,
+) ([]time.Time, []T, error) {
+	return v.h.Bucket(from, to, interval, sum, div, keepEmpty)
+}
+
+func (v *HistoryView[T]) BucketCtx(
+	ctx context.Context,
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+	keepEmpty bool,
+) ([]time.Time, []T, error) {
+	return v.h.BucketCtx(ctx, from, to, interval, sum, div, keepEmpty)
+}
+
+func (v *HistoryView[T]) CountBuckets(from time.Time, to time.Time, interval time.Duration) ([]time.Time, []int, error) {
+	return v.h.CountBuckets(from, to, interval)
+}
+
+func (v *HistoryView[T]) BucketPercentiles(
+	from time.Time,
+	to time.Time,
+	interval time.Duration,
+	ps []float64,
+	less func(a T, b T) bool,
+) ([]time.Time, [][]T, error) {
+	return v.h.BucketPercentiles(from, to, interval, ps, less)
+}
+
+func (v *HistoryView[T]) Resample(
+	from time.Time,
+	to time.Time,
+	step time.Duration,
+	lerp func(a T, b T, frac float64) T,
+) ([]time.Time, []T, error) {
+	return v.h.Resample(from, to, step, lerp)
+}
+
+func (v *HistoryView[T]) Rate(
+	from time.Time,
+	to time.Time,
+	sub func(a T, b T) T,
+	perSecond func(delta T, d time.Duration) float64,
+) (float64, error) {
+	return v.h.Rate(from, to, sub, perSecond)
+}
+
+func (v *HistoryView[T]) Derivative(
+	from time.Time,
+	to time.Time,
+	sub func(a T, b T) T,
+	perSecond func(delta T, d time.Duration) float64,
+) ([]time.Time, []float64, error) {
+	return v.h.Derivative(from, to, sub, perSecond)
+}
+
+func (v *HistoryView[T]) Delta(from time.Time, to time.Time, sub func(toItem T, fromItem T) T) (T, error) {
+	return v.h.Delta(from, to, sub)
+}
+
+func (v *HistoryView[T]) TrailingSum() (T, bool) {
+	return v.h.TrailingSum()
+}
+
+func (v *HistoryView[T]) TrailingAvg(div func(a T, n int) T) (T, error) {
+	return v.h.TrailingAvg(div)
+}
+
+func (v *HistoryView[T]) ApproxPercentile(p float64) (float64, error) {
+	return v.h.ApproxPercentile(p)
+}
+
+func (v *HistoryView[T]) Correlate(other *History[T], from time.Time, to time.Time, a func(it T) float64, b func(it T) float64) (float64, error) {
+	return v.h.Correlate(other, from, to, a, b)
+}
+
+func (v *HistoryView[T]) Equal(other *History[T], itemEqual func(a T, b T) bool) bool {
+	return v.h.Equal(other, itemEqual)
+}
+
+func (v *HistoryView[T]) ApproxBytes() int {
+	return v.h.ApproxBytes()
+}
+
+func (v *HistoryView[T]) Validate() error {
+	return v.h.Validate()
+}
+
+func (v *HistoryView[T]) MarshalJSON() ([]byte, error) {
+	return v.h.MarshalJSON()
+}
+
+func (v *HistoryView[T]) WriteCSV(w io.Writer, from time.Time, to time.Time, format func(it T) []string) error {
+	return v.h.WriteCSV(w, from, to, format)
+}
+
+func (v *HistoryView[T]) Replay(ctx context.Context, from time.Time, to time.Time, speed float64, emit func(e Entry[T])) error {
+	return v.h.Replay(ctx, from, to, speed, emit)
+}
+
+func (v *HistoryView[T]) Next(c *Cursor, n int) []Entry[T] {
+	return v.h.Next(c, n)
+}
+
+func (v *HistoryView[T]) NDJSONReader(from time.Time, to time.Time, encode func(e Entry[T]) ([]byte, error)) io.Reader {
+	return v.h.NDJSONReader(from, to, encode)
+}
+
+func (v *HistoryView[T]) ByValueRange(lo float64, hi float64) ([]Entry[T], error) {
+	return v.h.ByValueRange(lo, hi)
+}
+
+func (v *HistoryView[T]) Diagnostics() Report {
+	return v.h.Diagnostics()
+}
+
+func (v *HistoryView[T]) String() string {
+	return v.h.String()
+}
+
+func (v *HistoryView[T]) Dump(w io.Writer) error {
+	return v.h.Dump(w)
+}
+
+func (v *HistoryView[T]) OpLatencies() map[string]LatencyStats {
+	return v.h.OpLatencies()
+}
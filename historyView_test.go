@@ -0,0 +1,42 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+// a view sees Adds made through the History it wraps
+func TestReadOnly(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	v := lg.ReadOnly()
+	tm := time.Unix(0, 0)
+	if v.Len() != 0 {
+		t.Error("expected an empty view")
+	}
+
+	for i := 0; i < 3; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if v.Len() != 3 {
+		t.Error("view did not see the adds, len", v.Len())
+	}
+	if it, _, err := v.Before(tm.Add(time.Duration(1500) * time.Millisecond)); err != nil || it != 1 {
+		t.Error("expected 1, got", it, err)
+	}
+	if entries, err := v.Range(tm, tm.Add(time.Minute)); err != nil || len(entries) != 3 {
+		t.Error("expected 3 entries, got", entries, err)
+	}
+}
+
+// a view reads the latencies of the History it wraps
+func TestViewOpLatencies(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithOpLatencies())
+	v := lg.ReadOnly()
+	lg.Add(time.Unix(0, 0), 0)
+	v.Range(time.Unix(0, 0), time.Unix(1, 0))
+
+	ops := v.OpLatencies()
+	if ops["Add"].Count != 1 || ops["Range"].Count != 1 {
+		t.Error("expected 1 Add and 1 Range, got", ops)
+	}
+}
@@ -1,15 +1,26 @@
 package history
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 // the log can store items and retrieve them
 func TestAddOneNonUnique(t *testing.T) {
 	dummyItem := struct{}{}
-	lg := MakeHistory(time.Duration(10) * time.Millisecond)
+	lg := MakeHistory[struct{}](time.Duration(10) * time.Millisecond)
 
 	tm := time.Now()
 	lg.Add(tm, dummyItem)
@@ -31,7 +42,7 @@ func TestAddOneNonUnique(t *testing.T) {
 
 // the legnth of the log doesn't exceed its time allotment
 func TestTimeLimitNonUnique(t *testing.T) {
-	lg := MakeHistory(time.Duration(5) * time.Millisecond)
+	lg := MakeHistory[time.Time](time.Duration(5) * time.Millisecond)
 
 	tm := time.Now()
 	stopAdd := tm.Add(time.Duration(50) * time.Millisecond)
@@ -53,7 +64,7 @@ func TestTimeLimitNonUnique(t *testing.T) {
 
 // the log always has at least 100 items
 func TestCountLimitNonUnique(t *testing.T) {
-	lg := MakeHistory(time.Duration(1) * time.Millisecond)
+	lg := MakeHistory[time.Time](time.Duration(1) * time.Millisecond)
 
 	tm := time.Now()
 	stopAdd := tm.Add(time.Duration(300) * time.Millisecond)
@@ -69,3 +80,2483 @@ func TestCountLimitNonUnique(t *testing.T) {
 		t.Error("length incorrect:", lg.Len(), span)
 	}
 }
+
+// linear reference for the window methods
+func linearBetween(lg *History[int], from time.Time, to time.Time, b Bounds) (int, int) {
+	count, sum := 0, 0
+	for _, t := range lg.times {
+		afterFrom := t.After(from) || (b.includesFrom() && t.Equal(from))
+		beforeTo := t.Before(to) || (b.includesTo() && t.Equal(to))
+		if afterFrom && beforeTo {
+			count++
+			sum += lg.t[t]
+		}
+	}
+	return count, sum
+}
+
+// a window of one item averages to it, and a boundary item counts as the
+// bounds say
+func TestAvgBetweenSingle(t *testing.T) {
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	tm := time.Unix(0, 0)
+	lg := MakeHistory[int](time.Hour)
+	lg.Add(tm, 4)
+	lg.Add(tm.Add(time.Minute), 8)
+
+	if avg, err := lg.AvgBetween(tm.Add(time.Minute), tm.Add(time.Hour), sum, div); err != nil || avg != 8 {
+		t.Error("expected the item at from, got", avg, err)
+	}
+	if _, err := lg.AvgBetween(tm.Add(time.Second), tm.Add(time.Minute), sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected the item at to left out, got", err)
+	}
+	if _, err := lg.AvgBetween(tm.Add(time.Minute), tm.Add(time.Minute), sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected from == to to be empty, got", err)
+	}
+
+	closed := MakeHistory[int](time.Hour, WithBounds(Closed))
+	closed.Add(tm, 4)
+	closed.Add(tm.Add(time.Minute), 8)
+	if avg, err := closed.AvgBetween(tm.Add(time.Minute), tm.Add(time.Minute), sum, div); err != nil || avg != 8 {
+		t.Error("expected the item at from == to under Closed, got", avg, err)
+	}
+	if avg, err := closed.AvgBetween(tm.Add(time.Second), tm.Add(time.Minute), sum, div); err != nil || avg != 8 {
+		t.Error("expected the item at to under Closed, got", avg, err)
+	}
+}
+
+// the binary searched window matches a linear scan under every bounds
+func TestBetweenMatchesLinear(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	start := time.Unix(0, 0)
+
+	for round := 0; round < 50; round++ {
+		b := Bounds(round % 4)
+		lg := MakeHistory[int](time.Duration(1)*time.Hour, WithBounds(b))
+		tm := start
+		for i := 0; i < 1+rng.Intn(500); i++ {
+			tm = tm.Add(time.Duration(1+rng.Intn(10)) * time.Millisecond)
+			lg.Add(tm, i)
+		}
+		span := int(tm.Sub(start) / time.Millisecond)
+
+		for q := 0; q < 100; q++ {
+			from := start.Add(time.Duration(rng.Intn(span+20)-10) * time.Millisecond)
+			to := from.Add(time.Duration(rng.Intn(span/2+10)-5) * time.Millisecond)
+			wantCount, wantSum := linearBetween(lg, from, to, b)
+
+			count, err := lg.NumItemsBetween(from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != wantCount {
+				t.Error(b, "NumItemsBetween got", count, "expected", wantCount)
+			}
+
+			if entries, _ := lg.Range(from, to); len(entries) != wantCount {
+				t.Error(b, "Range got", len(entries), "expected", wantCount)
+			}
+
+			avg, err := lg.AvgBetween(from, to,
+				func(a int, b int) int { return a + b },
+				func(a int, n int) int { return a * 1000 / n },
+			)
+			if wantCount == 0 {
+				if err == nil {
+					t.Error(b, "AvgBetween expected error on empty window")
+				}
+			} else if err != nil {
+				t.Error(err)
+			} else if avg != wantSum*1000/wantCount {
+				t.Error(b, "AvgBetween got", avg, "expected", wantSum*1000/wantCount)
+			}
+		}
+	}
+}
+
+// the linear scan AvgBetween did before binary search, kept as the
+// reference. its (from, to) window is now WithBounds(Open).
+func oldLinearAvg(lg *History[int], from time.Time, to time.Time) (int, int) {
+	cum := 0
+	count := 0
+	for _, t := range lg.times {
+		if t.After(from) {
+			if t.Before(to) {
+				cum += lg.t[t]
+				count++
+			} else {
+				break
+			}
+		}
+	}
+	return count, cum
+}
+
+// under WithBounds(Open) AvgBetween and NumItemsBetween agree with the old
+// linear AvgBetween. the old NumItemsBetween is not the reference: its
+// search clamped to the last index, so it left out the newest item when
+// end was past it, which binary search fixed.
+func TestBetweenMatchesOldLinear(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	start := time.Unix(0, 0)
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a * 1000 / n }
+
+	for round := 0; round < 20; round++ {
+		lg := MakeHistory[int](time.Hour, WithBounds(Open))
+		tm := start
+		for i := 0; i < 1+rng.Intn(500); i++ {
+			tm = tm.Add(time.Duration(1+rng.Intn(10)) * time.Millisecond)
+			lg.Add(tm, i)
+		}
+		span := int(tm.Sub(start) / time.Millisecond)
+
+		for q := 0; q < 100; q++ {
+			from := start.Add(time.Duration(rng.Intn(span+20)-10) * time.Millisecond)
+			to := from.Add(time.Duration(rng.Intn(span/2+10)-5) * time.Millisecond)
+			wantCount, wantSum := oldLinearAvg(lg, from, to)
+
+			if count, _ := lg.NumItemsBetween(from, to); count != wantCount {
+				t.Error("NumItemsBetween got", count, "expected", wantCount)
+			}
+			avg, err := lg.AvgBetween(from, to, sum, div)
+			if wantCount == 0 {
+				if !errors.Is(err, ErrNoValues) {
+					t.Error("AvgBetween expected no values, got", avg, err)
+				}
+			} else if err != nil || avg != wantSum*1000/wantCount {
+				t.Error("AvgBetween got", avg, err, "expected", wantSum*1000/wantCount)
+			}
+		}
+	}
+}
+
+// the untyped shim stores arbitrary items
+func TestAnyHistory(t *testing.T) {
+	lg := MakeAnyHistory(time.Duration(10) * time.Millisecond)
+
+	tm := time.Now()
+	lg.Add(tm, "a")
+	lg.Add(tm.Add(time.Millisecond), 42)
+
+	p, _, err := lg.Before(tm)
+	if err != nil || p != "a" {
+		t.Error("stored data incorrect:", p, err)
+	}
+
+	p, _, err = lg.Before(tm.Add(time.Millisecond))
+	if err != nil || p != 42 {
+		t.Error("stored data incorrect:", p, err)
+	}
+}
+
+// After returns the first item strictly after the wanted time
+func TestAfter(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, _, err := lg.After(tm); err == nil {
+		t.Error("expected error on empty log")
+	}
+
+	for i := 0; i < 20; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	p, ti, err := lg.After(tm.Add(time.Duration(4500) * time.Millisecond))
+	if err != nil || p != 5 || !ti.Equal(tm.Add(time.Duration(5)*time.Second)) {
+		t.Error("After between items incorrect:", p, ti, err)
+	}
+
+	p, _, err = lg.After(tm.Add(time.Duration(4) * time.Second))
+	if err != nil || p != 5 {
+		t.Error("After on exact item incorrect:", p, err)
+	}
+
+	p, _, err = lg.After(tm.Add(-time.Second))
+	if err != nil || p != 0 {
+		t.Error("After before log start incorrect:", p, err)
+	}
+
+	if _, _, err = lg.After(tm.Add(time.Duration(19) * time.Second)); err == nil {
+		t.Error("expected error at log end")
+	}
+}
+
+// Nearest picks the closer neighbour, the earlier one on ties
+func TestNearest(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, _, err := lg.Nearest(tm); err == nil {
+		t.Error("expected error on empty log")
+	}
+
+	for i := 0; i < 20; i++ {
+		lg.Add(tm.Add(time.Duration(i*10)*time.Millisecond), i)
+	}
+
+	cases := []struct {
+		at   time.Duration
+		want int
+	}{
+		{-50, 0},
+		{0, 0},
+		{14, 1},
+		{15, 1},
+		{16, 2},
+		{190, 19},
+		{500, 19},
+	}
+	for _, c := range cases {
+		p, _, err := lg.Nearest(tm.Add(c.at * time.Millisecond))
+		if err != nil || p != c.want {
+			t.Error("Nearest at", c.at, "got", p, "expected", c.want, err)
+		}
+	}
+}
+
+// the minimum retained count is configurable
+func TestMinKeep(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Duration(10)*time.Millisecond, 5)
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 50; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() != 5 {
+		t.Error("length incorrect:", lg.Len(), "expected 5")
+	}
+
+	lg.UpdateMinKeep(-3)
+	lg.Add(tm.Add(time.Duration(50)*time.Second), 50)
+	if lg.Len() != 1 {
+		t.Error("length incorrect:", lg.Len(), "expected 1")
+	}
+
+	if lg := MakeHistoryWithMin[int](time.Second, -1); lg.minKeep != 0 {
+		t.Error("negative minKeep not clamped:", lg.minKeep)
+	}
+}
+
+// errors can be told apart with errors.Is
+func TestSentinelErrors(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	if _, _, err := lg.Before(tm); !errors.Is(err, ErrEmpty) {
+		t.Error("Before on empty log:", err)
+	}
+	if _, err := lg.NumItemsBetween(tm, tm); !errors.Is(err, ErrEmpty) {
+		t.Error("NumItemsBetween on empty log:", err)
+	}
+
+	lg.Add(tm, 1)
+	if _, _, err := lg.Before(tm.Add(-time.Second)); !errors.Is(err, ErrBeforeStart) {
+		t.Error("Before log start:", err)
+	}
+	if _, _, err := lg.After(tm); !errors.Is(err, ErrAfterEnd) {
+		t.Error("After log end:", err)
+	}
+	if _, err := lg.AvgBetween(tm.Add(time.Millisecond), tm.Add(time.Second), sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("AvgBetween on empty window:", err)
+	}
+}
+
+// Range returns copies of the entries in [from, to)
+func TestRange(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, err := lg.Range(tm, tm); !errors.Is(err, ErrEmpty) {
+		t.Error("Range on empty log:", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	entries, err := lg.Range(tm.Add(time.Duration(2)*time.Second), tm.Add(time.Duration(5)*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Item != 2 || entries[2].Item != 4 {
+		t.Error("Range items incorrect:", entries)
+	}
+	if !entries[0].Time.Equal(tm.Add(time.Duration(2) * time.Second)) {
+		t.Error("Range times incorrect:", entries)
+	}
+
+	entries[0].Time = tm.Add(time.Hour)
+	if !lg.times[2].Equal(tm.Add(time.Duration(2) * time.Second)) {
+		t.Error("Range returned a view into internal state")
+	}
+
+	if entries, _ = lg.Range(tm.Add(time.Second), tm); len(entries) != 0 {
+		t.Error("Range on inverted window:", entries)
+	}
+}
+
+// ForEach walks [from, to) in order and stops when asked
+func TestForEach(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	seen := make([]int, 0)
+	lg.ForEach(tm.Add(time.Duration(2)*time.Second), tm.Add(time.Duration(6)*time.Second), func(ti time.Time, it int) bool {
+		seen = append(seen, it)
+		return true
+	})
+	if len(seen) != 4 || seen[0] != 2 || seen[3] != 5 {
+		t.Error("ForEach visited", seen)
+	}
+
+	count := 0
+	lg.ForEach(tm, tm.Add(time.Hour), func(ti time.Time, it int) bool {
+		count++
+		return it < 3
+	})
+	if count != 4 {
+		t.Error("ForEach did not stop early, visited", count)
+	}
+}
+
+// an exact duplicate timestamp is rejected by Add and replaced by AddOrReplace
+func TestDuplicateTimestamp(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, err := lg.Add(tm, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lg.Add(tm, 2); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+	if p, _, _ := lg.Before(tm); p != 1 || lg.Len() != 1 {
+		t.Error("duplicate Add changed state:", p, lg.Len())
+	}
+
+	lg.AddOrReplace(tm, 3)
+	lg.AddOrReplace(tm.Add(time.Second), 4)
+	if p, _, _ := lg.Before(tm); p != 3 || lg.Len() != 2 {
+		t.Error("AddOrReplace incorrect:", p, lg.Len())
+	}
+}
+
+// late arrivals are inserted in time order
+func TestOutOfOrderAdd(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	order := []int{0, 1, 5, 2, 6, 3, 9, 4, 7, 8, -1}
+	for _, i := range order {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if !slices.IsSortedFunc(lg.times, func(a time.Time, b time.Time) int { return a.Compare(b) }) {
+		t.Error("times not sorted:", lg.times)
+	}
+	for i := -1; i < 10; i++ {
+		p, _, err := lg.Before(tm.Add(time.Duration(i)*time.Second + time.Millisecond))
+		if err != nil || p != i {
+			t.Error("Before after late add got", p, "expected", i, err)
+		}
+	}
+
+	avg, err := lg.AvgBetween(tm, tm.Add(time.Duration(4)*time.Second),
+		func(a int, b int) int { return a + b },
+		func(a int, n int) int { return a / n },
+	)
+	if err != nil || avg != 1 {
+		t.Error("AvgBetween after late add got", avg, "expected 1", err)
+	}
+}
+
+// items can be removed individually or by age
+func TestRemove(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if !lg.Remove(tm.Add(time.Duration(5) * time.Second)) {
+		t.Error("Remove of stored time returned false")
+	}
+	if lg.Remove(tm.Add(time.Duration(5) * time.Second)) {
+		t.Error("Remove of missing time returned true")
+	}
+	if p, _, _ := lg.Before(tm.Add(time.Duration(5) * time.Second)); p != 4 || lg.Len() != 9 {
+		t.Error("Remove left incorrect state:", p, lg.Len())
+	}
+
+	if n := lg.RemoveBefore(tm.Add(time.Duration(3) * time.Second)); n != 3 {
+		t.Error("RemoveBefore removed", n, "expected 3")
+	}
+	if lg.Len() != 6 || len(lg.t) != 6 {
+		t.Error("RemoveBefore left incorrect state:", lg.Len(), len(lg.t))
+	}
+	if p, _, _ := lg.Before(tm.Add(time.Duration(3) * time.Second)); p != 3 {
+		t.Error("oldest after RemoveBefore is", p, "expected 3")
+	}
+}
+
+// Clear and Reset empty the log but keep it usable
+func TestClearReset(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Duration(1)*time.Hour, 7)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	lg.Clear()
+	if lg.Len() != 0 || len(lg.t) != 0 {
+		t.Error("Clear left items:", lg.Len(), len(lg.t))
+	}
+	if lg.length != time.Hour || lg.minKeep != 7 {
+		t.Error("Clear changed configuration:", lg.length, lg.minKeep)
+	}
+
+	lg.Add(tm, 1)
+	lg.Reset(time.Minute)
+	if lg.Len() != 0 || lg.length != time.Minute {
+		t.Error("Reset incorrect:", lg.Len(), lg.length)
+	}
+	if _, err := lg.Add(tm, 2); err != nil || lg.Len() != 1 {
+		t.Error("Add after Reset failed:", err, lg.Len())
+	}
+}
+
+// readers and a writer can use the log concurrently
+func TestConcurrentReaders(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				lg.Len()
+				lg.Before(tm.Add(time.Duration(i) * time.Millisecond))
+				lg.NumItemsBetween(tm, tm.Add(time.Second))
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Millisecond), i)
+	}
+	wg.Wait()
+
+	if lg.Len() != 1000 {
+		t.Error("length incorrect:", lg.Len(), "expected 1000")
+	}
+}
+
+// Oldest and Newest return the ends of the log
+func TestOldestNewest(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, _, ok := lg.Oldest(); ok {
+		t.Error("Oldest on empty log returned ok")
+	}
+	if _, _, ok := lg.Newest(); ok {
+		t.Error("Newest on empty log returned ok")
+	}
+
+	for _, i := range []int{3, 1, 7, 5} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if p, ti, ok := lg.Oldest(); !ok || p != 1 || !ti.Equal(tm.Add(time.Second)) {
+		t.Error("Oldest incorrect:", p, ti, ok)
+	}
+	if p, ti, ok := lg.Newest(); !ok || p != 7 || !ti.Equal(tm.Add(time.Duration(7)*time.Second)) {
+		t.Error("Newest incorrect:", p, ti, ok)
+	}
+}
+
+// Span covers the oldest to the newest item
+func TestSpan(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	if _, _, _, ok := lg.Span(); ok {
+		t.Error("Span on empty log returned ok")
+	}
+
+	lg.Add(tm, 0)
+	if oldest, newest, d, ok := lg.Span(); ok || !oldest.Equal(tm) || !newest.Equal(tm) || d != 0 {
+		t.Error("Span on single item incorrect:", oldest, newest, d, ok)
+	}
+
+	lg.Add(tm.Add(time.Minute), 1)
+	if oldest, newest, d, ok := lg.Span(); !ok || !oldest.Equal(tm) || !newest.Equal(tm.Add(time.Minute)) || d != time.Minute {
+		t.Error("Span incorrect:", oldest, newest, d, ok)
+	}
+}
+
+// capacity limits the count independently of and together with length
+func TestCapacity(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](10)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 50; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Hour), i)
+	}
+	if p, _, _ := lg.Oldest(); lg.Len() != 10 || p != 40 {
+		t.Error("capacity eviction incorrect:", lg.Len(), p)
+	}
+
+	lg.UpdateDuration(time.Duration(3) * time.Hour)
+	lg.Add(tm.Add(time.Duration(50)*time.Hour), 50)
+	if lg.Len() != 4 {
+		t.Error("length incorrect:", lg.Len(), "expected 4")
+	}
+
+	lg = MakeHistoryWithMin[int](time.Hour, 20)
+	lg.UpdateCapacity(5)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() != 5 {
+		t.Error("capacity did not win over minKeep:", lg.Len())
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// an injected clock replaces time.Now
+func TestWithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lg := MakeHistory[int](time.Duration(1)*time.Hour, WithClock(clock))
+
+	if _, ti, err := lg.Before(time.Unix(0, 0)); !errors.Is(err, ErrEmpty) || !ti.Equal(clock.now) {
+		t.Error("empty Before did not use clock:", ti, err)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if _, ti, _ := lg.After(time.Unix(0, 0)); !ti.Equal(clock.now) {
+		t.Error("empty After did not use clock:", ti)
+	}
+}
+
+// Snapshot copies all entries in order
+func TestSnapshot(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for _, i := range []int{2, 0, 1} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	snap := lg.Snapshot()
+	lg.Add(tm.Add(time.Duration(3)*time.Second), 3)
+
+	if len(snap) != 3 {
+		t.Fatal("Snapshot length incorrect:", len(snap))
+	}
+	for i, e := range snap {
+		if e.Item != i || !e.Time.Equal(tm.Add(time.Duration(i)*time.Second)) {
+			t.Error("Snapshot entry", i, "incorrect:", e)
+		}
+	}
+}
+
+// Merge interleaves two histories and keeps the receiver's duplicates
+func TestMerge(t *testing.T) {
+	a := MakeHistory[int](time.Duration(1) * time.Hour)
+	b := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			a.Add(tm.Add(time.Duration(i)*time.Second), i)
+		} else {
+			b.Add(tm.Add(time.Duration(i)*time.Second), i)
+		}
+	}
+	b.Add(tm, 100)
+
+	if err := a.Merge(b); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+	snap := a.Snapshot()
+	if len(snap) != 10 || len(a.t) != 10 {
+		t.Fatal("merged length incorrect:", len(snap), len(a.t))
+	}
+	for i, e := range snap {
+		if e.Item != i {
+			t.Error("merged entry", i, "is", e.Item)
+		}
+	}
+	if b.Len() != 6 {
+		t.Error("Merge changed the other history:", b.Len())
+	}
+
+	// merging in both directions at once does not deadlock
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); a.Merge(b) }()
+	go func() { defer wg.Done(); b.Merge(a) }()
+	wg.Wait()
+}
+
+// a Clone can be changed without affecting the original
+func TestClone(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Duration(1)*time.Hour, 5)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	c := lg.Clone()
+	if c.Len() != 10 || c.minKeep != 5 || c.length != time.Hour {
+		t.Error("Clone incorrect:", c.Len(), c.minKeep, c.length)
+	}
+
+	c.Remove(tm)
+	c.Add(tm.Add(-time.Second), -1)
+	c.AddOrReplace(tm.Add(time.Second), 100)
+	c.UpdateMinKeep(1)
+
+	if p, _, _ := lg.Oldest(); p != 0 || lg.Len() != 10 || lg.minKeep != 5 {
+		t.Error("original changed:", p, lg.Len(), lg.minKeep)
+	}
+	if p, _, _ := lg.Before(tm.Add(time.Second)); p != 1 {
+		t.Error("original item replaced:", p)
+	}
+}
+
+// OnEvict sees each evicted entry and may call back into the History
+func TestOnEvict(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](3)
+	tm := time.Unix(0, 0)
+
+	evicted := make([]int, 0)
+	lg.OnEvict(func(ti time.Time, it int) {
+		evicted = append(evicted, it)
+		lg.Len()
+	})
+	for i := 0; i < 6; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if !slices.Equal(evicted, []int{0, 1, 2}) {
+		t.Error("evicted", evicted, "expected [0 1 2]")
+	}
+
+	lg.OnEvict(nil)
+	lg.Add(tm.Add(time.Duration(6)*time.Second), 6)
+	if len(evicted) != 3 || len(lg.evicted) != 0 {
+		t.Error("hook called after removal:", evicted, lg.evicted)
+	}
+}
+
+// ApproxBytes grows with the items and their size hint
+func TestApproxBytes(t *testing.T) {
+	small := MakeHistory[int](time.Duration(1) * time.Hour)
+	large := MakeHistory[int](time.Duration(1)*time.Hour, WithItemSize(1000))
+	tm := time.Unix(0, 0)
+
+	empty := small.ApproxBytes()
+	for i := 0; i < 100; i++ {
+		small.Add(tm.Add(time.Duration(i)*time.Second), i)
+		large.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if small.ApproxBytes() < empty+100*(24+8) {
+		t.Error("estimate too small:", small.ApproxBytes())
+	}
+	if large.ApproxBytes() < 100*1000 || large.ApproxBytes() <= small.ApproxBytes() {
+		t.Error("item size hint ignored:", large.ApproxBytes(), small.ApproxBytes())
+	}
+}
+
+// Add evicts the oldest items until the estimate is back under budget
+func TestByteBudget(t *testing.T) {
+	lg := MakeHistoryWithByteBudget[int](10_000, 1000)
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() == 0 || lg.Len() >= 10 {
+		t.Fatal("expected the budget to hold under 10 items, got", lg.Len())
+	}
+	if it, _, _ := lg.Newest(); it != 99 {
+		t.Error("expected the newest item kept, got", it)
+	}
+	if it, _, _ := lg.Oldest(); it != 100-lg.Len() {
+		t.Error("expected the oldest items evicted, oldest is", it)
+	}
+
+	lg.UpdateMinKeep(20)
+	for i := 100; i < 130; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() != 20 {
+		t.Error("expected minKeep to hold back the budget, got", lg.Len())
+	}
+}
+
+// a budget smaller than one item keeps nothing, without panicking
+func TestByteBudgetBelowItem(t *testing.T) {
+	lg := MakeHistoryWithByteBudget[int](10, 8)
+	if _, err := lg.Add(time.Unix(0, 0), 1); err != nil {
+		t.Error("expected the add to succeed, got", err)
+	}
+	if lg.Len() != 0 {
+		t.Error("expected the item evicted by the budget, got", lg.Len())
+	}
+}
+
+// AutoDuration follows the add rate to keep about the target count
+func TestAutoDuration(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Hour, 0)
+	lg.AutoDuration(10)
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() != 10 {
+		t.Error("expected 10 items at 1/s, got", lg.Len())
+	}
+
+	tm = tm.Add(100 * time.Second)
+	for i := 0; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Minute), i)
+	}
+	if n := lg.Len(); n < 9 || n > 11 {
+		t.Error("expected about 10 items at 1/min, got", n)
+	}
+
+	lg.UpdateDuration(time.Hour)
+	for i := 100; i < 200; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Minute), i)
+	}
+	if lg.Len() != 61 {
+		t.Error("expected UpdateDuration to turn it off, got", lg.Len())
+	}
+}
+
+// the times slice is allocated once while filling up to the initial capacity
+func TestWithInitialCapacity(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithInitialCapacity(100))
+	tm := time.Unix(0, 0)
+	if cap(lg.times) != 100 {
+		t.Fatal("expected room for 100 items, got", cap(lg.times))
+	}
+
+	lg.Add(tm, 0)
+	first := &lg.times[0]
+	for i := 1; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if &lg.times[0] != first {
+		t.Error("expected no reallocation while filling")
+	}
+
+	lg.Clear()
+	if cap(lg.times) != 100 {
+		t.Error("expected Clear to keep the initial capacity, got", cap(lg.times))
+	}
+}
+
+// AddRate counts items per second over the window or the History's age
+func TestAddRate(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistory[int](time.Hour, WithClock(clock))
+	if _, err := lg.AddRate(time.Minute); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	lg.Add(tm, 0)
+	if _, err := lg.AddRate(time.Minute); !errors.Is(err, ErrTooFew) {
+		t.Error("expected too few error, got", err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second/2), i)
+	}
+	clock.now = tm.Add(50 * time.Second)
+	if rate, err := lg.AddRate(10 * time.Second); err != nil || rate != 2 {
+		t.Error("expected 2/s over 10s, got", rate, err)
+	}
+	if rate, err := lg.AddRate(time.Hour); err != nil || rate < 1.95 || rate > 2 {
+		t.Error("expected 2/s over the History's age, got", rate, err)
+	}
+}
+
+// TruncateToLast keeps the newest n even below minKeep
+func TestTruncateToLast(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Hour, 10)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 20; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	if n := lg.TruncateToLast(3); n != 17 || lg.Len() != 3 {
+		t.Fatal("expected 17 removed and 3 left, got", n, lg.Len())
+	}
+	if it, _, _ := lg.Oldest(); it != 17 {
+		t.Error("expected the newest 3 kept, oldest is", it)
+	}
+	if n := lg.TruncateToLast(5); n != 0 || lg.Len() != 3 {
+		t.Error("expected nothing removed, got", n, lg.Len())
+	}
+	if n := lg.TruncateToLast(-1); n != 3 || lg.Len() != 0 {
+		t.Error("expected a negative n to empty it, got", n, lg.Len())
+	}
+}
+
+// every Add racing Drain ends up in exactly one drained batch
+func TestDrain(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			lg.Add(tm.Add(time.Duration(i)*time.Millisecond), i)
+		}
+	}()
+	for seen := 0; seen < 1000; {
+		for _, e := range lg.Drain() {
+			if e.Item != seen {
+				t.Fatal("expected item", seen, "got", e.Item)
+			}
+			seen++
+		}
+	}
+	wg.Wait()
+
+	if lg.Len() != 0 {
+		t.Error("expected Drain to empty the History, got", lg.Len())
+	}
+}
+
+// WithSeq numbers items in the order they were stored
+func TestWithSeq(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithSeq())
+	tm := time.Unix(0, 0)
+	lg.Add(tm.Add(2*time.Second), 0)
+	e, _ := lg.Add(tm, 1)
+	if e.Seq != 2 {
+		t.Error("expected Add to return the Seq, got", e.Seq)
+	}
+	lg.Add(tm.Add(time.Second), 2)
+	lg.AddOrReplace(tm, 3)
+
+	var seqs, items []int
+	for _, e := range lg.Snapshot() {
+		seqs = append(seqs, int(e.Seq))
+		items = append(items, e.Item)
+	}
+	if !slices.Equal(seqs, []int{4, 3, 1}) || !slices.Equal(items, []int{3, 2, 0}) {
+		t.Error("unexpected order", seqs, items)
+	}
+
+	b, _ := lg.MarshalJSON()
+	loaded := MakeHistory[int](time.Hour, WithSeq())
+	if err := loaded.UnmarshalJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	if s := loaded.Snapshot(); s[0].Seq != 1 || s[2].Seq != 3 || s[2].Item != 0 {
+		t.Error("expected loaded items numbered in order, got", s)
+	}
+
+	plain := MakeHistory[int](time.Hour)
+	if e, _ := plain.Add(tm, 0); e.Seq != 0 {
+		t.Error("expected no Seq without WithSeq, got", e.Seq)
+	}
+}
+
+// ExportFloats gives copies that later Adds and edits leave alone
+func TestExportFloats(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	if _, _, err := lg.ExportFloats(tm, tm, nil); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	ts, vs, err := lg.ExportFloats(tm.Add(time.Second), tm.Add(4*time.Second), func(it int) float64 { return float64(it) / 2 })
+	if err != nil || len(ts) != 3 || !ts[0].Equal(tm.Add(time.Second)) || !slices.Equal(vs, []float64{0.5, 1, 1.5}) {
+		t.Fatal("ExportFloats got", ts, vs, err)
+	}
+	ts[0] = tm
+	if _, then, _ := lg.Before(tm.Add(time.Second)); !then.Equal(tm.Add(time.Second)) {
+		t.Error("expected the times to be a copy")
+	}
+}
+
+// XYs gives seconds since the epoch, fractions included, against y
+func TestXYs(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(100, 0)
+	if _, err := lg.XYs(tm, tm, nil); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	for i := 0; i < 4; i++ {
+		lg.Add(tm.Add(time.Duration(i)*500*time.Millisecond), i)
+	}
+
+	xys, err := lg.XYs(tm.Add(time.Second/2), tm.Add(time.Hour), func(it int) float64 { return float64(it * 10) })
+	want := []XY{{100.5, 10}, {101, 20}, {101.5, 30}}
+	if err != nil || !slices.Equal(xys, want) {
+		t.Error("XYs got", xys, err, "expected", want)
+	}
+}
+
+// the ceiling evicts a burst inside length, even below minKeep, and warns
+func TestWithMaxEntries(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	lg := MakeHistoryWithMin[int](24*time.Hour, 100, WithMaxEntries(10), WithLogger(logger))
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 50; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Millisecond), i)
+	}
+	if lg.Len() != 10 {
+		t.Error("expected the ceiling to hold 10 items, got", lg.Len())
+	}
+	if it, _, _ := lg.Oldest(); it != 40 {
+		t.Error("expected the oldest evicted, oldest is", it)
+	}
+	if !strings.Contains(buf.String(), "max entries reached") {
+		t.Error("expected a warning, got", buf.String())
+	}
+}
+
+// WithRecover returns a panicking callback as an error and frees the lock
+func TestWithRecover(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithRecover())
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.Add(tm.Add(time.Second), 1)
+
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / (n - 2) }
+	if _, err := lg.AvgBetween(tm, tm.Add(time.Minute), sum, div); !errors.Is(err, ErrPanic) {
+		t.Error("expected panic error, got", err)
+	}
+	if _, _, err := lg.MinBetween(tm, tm.Add(time.Minute), func(a int, b int) bool { panic("bad item") }); !errors.Is(err, ErrPanic) || !strings.Contains(err.Error(), "bad item") {
+		t.Error("expected panic error, got", err)
+	}
+	if _, _, err := lg.ExportFloats(tm, tm.Add(time.Minute), func(it int) float64 { panic("bad item") }); !errors.Is(err, ErrPanic) {
+		t.Error("expected panic error, got", err)
+	}
+	if _, err := lg.XYs(tm, tm.Add(time.Minute), func(it int) float64 { panic("bad item") }); !errors.Is(err, ErrPanic) {
+		t.Error("expected panic error, got", err)
+	}
+	if _, err := lg.Add(tm.Add(2*time.Second), 2); err != nil {
+		t.Error("expected the lock released, got", err)
+	}
+
+	plain := MakeHistory[int](time.Hour)
+	plain.Add(tm, 0)
+	defer func() {
+		if recover() == nil {
+			t.Error("expected the panic to propagate without WithRecover")
+		}
+	}()
+	plain.SumBetween(tm, tm.Add(time.Minute), func(a int, b int) int { panic("bad item") })
+}
+
+// IndexBounds slices a Snapshot to the window Range returns
+func TestIndexBounds(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	lo, hi := lg.IndexBounds(tm.Add(2*time.Second), tm.Add(5*time.Second))
+	if lo != 2 || hi != 5 {
+		t.Fatal("expected [2, 5), got", lo, hi)
+	}
+	want, _ := lg.Range(tm.Add(2*time.Second), tm.Add(5*time.Second))
+	if !slices.Equal(lg.Snapshot()[lo:hi], want) {
+		t.Error("expected the Snapshot slice to match Range")
+	}
+	if lo, hi := lg.IndexBounds(tm.Add(time.Minute), tm.Add(time.Hour)); lo != 10 || hi != 10 {
+		t.Error("expected an empty window at the end, got", lo, hi)
+	}
+}
+
+// CompareToPast compares the trailing window with the same one a lag ago
+func TestCompareToPast(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm.Add(48 * time.Hour)}
+	lg := MakeHistory[float64](72*time.Hour, WithClock(clock))
+	for h := 0; h < 48; h++ {
+		lg.Add(tm.Add(time.Duration(h)*time.Hour), float64(h))
+	}
+	sum := func(a float64, b float64) float64 { return a + b }
+	div := func(a float64, n int) float64 { return a / float64(n) }
+	id := func(v float64) float64 { return v }
+
+	current, past, ratio, err := lg.CompareToPast(2*time.Hour, 24*time.Hour, sum, div, id)
+	if err != nil || current != 46.5 || past != 22.5 || ratio != 46.5/22.5 {
+		t.Error("CompareToPast got", current, past, ratio, err)
+	}
+	if _, _, _, err := lg.CompareToPast(2*time.Hour, 7*24*time.Hour, sum, div, id); !errors.Is(err, ErrBeforeStart) {
+		t.Error("expected the past window before start, got", err)
+	}
+	if _, past, ratio, err := lg.CompareToPast(2*time.Hour, 47*time.Hour, sum, div, id); err != nil || past != 0 || !math.IsInf(ratio, 1) {
+		t.Error("expected +Inf against a zero past, got", past, ratio, err)
+	}
+	zero := func(float64) float64 { return 0 }
+	if _, _, ratio, err := lg.CompareToPast(2*time.Hour, 24*time.Hour, sum, div, zero); err != nil || !math.IsNaN(ratio) {
+		t.Error("expected NaN for zero over zero, got", ratio, err)
+	}
+}
+
+// NearestN takes the closest entries on either side, earlier ones on ties
+func TestNearestN(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for _, at := range []int{0, 10, 12, 14, 20, 30} {
+		lg.Add(tm.Add(time.Duration(at)*time.Second), at)
+	}
+	items := func(entries []Entry[int]) []int {
+		var its []int
+		for _, e := range entries {
+			its = append(its, e.Item)
+		}
+		return its
+	}
+
+	if got := items(lg.NearestN(tm.Add(13*time.Second), 3)); !slices.Equal(got, []int{10, 12, 14}) {
+		t.Error("expected [10 12 14], got", got)
+	}
+	if got := items(lg.NearestN(tm.Add(17*time.Second), 2)); !slices.Equal(got, []int{14, 20}) {
+		t.Error("expected [14 20], got", got)
+	}
+	if got := items(lg.NearestN(tm.Add(12*time.Second), 2)); !slices.Equal(got, []int{10, 12}) {
+		t.Error("expected the tie to go to the earlier, got", got)
+	}
+	if got := items(lg.NearestN(tm.Add(time.Hour), 2)); !slices.Equal(got, []int{20, 30}) {
+		t.Error("expected the newest two, got", got)
+	}
+	if got := lg.NearestN(tm, 10); len(got) != 6 {
+		t.Error("expected all entries, got", got)
+	}
+}
+
+// WithResolution rounds added times, and items rounding together collide
+func TestWithResolution(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithResolution(time.Second))
+	tm := time.Unix(100, 0)
+
+	if e, _ := lg.Add(tm.Add(1400*time.Millisecond), 0); !e.Time.Equal(tm.Add(time.Second)) {
+		t.Error("expected the time rounded, got", e.Time)
+	}
+	if _, err := lg.Add(tm.Add(600*time.Millisecond), 1); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected Add to reject a collision, got", err)
+	}
+	lg.AddOrReplace(tm.Add(1200*time.Millisecond), 2)
+	if it, ok := lg.Get(tm.Add(time.Second)); !ok || it != 2 {
+		t.Error("expected AddOrReplace to keep the last, got", it, ok)
+	}
+
+	if err := lg.AddBatch([]Entry[int]{{Time: tm.Add(2100 * time.Millisecond), Item: 3}, {Time: tm.Add(1900 * time.Millisecond), Item: 4}}); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected a collision inside the batch, got", err)
+	}
+	if lg.Len() != 2 {
+		t.Error("expected 2 items, got", lg.Len())
+	}
+}
+
+// WithTimeKey matches an instant in any location to the stored time
+func TestWithTimeKey(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithTimeKey(func(t time.Time) int64 { return t.UnixNano() }))
+	tm := time.Unix(100, 0).UTC()
+	zoned := tm.In(time.FixedZone("east", 3600))
+
+	lg.Add(tm, 1)
+	if _, err := lg.Add(zoned, 2); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected the zoned instant to be a duplicate, got", err)
+	}
+	if it, ok := lg.Get(zoned); !ok || it != 1 {
+		t.Error("expected Get to match across locations, got", it, ok)
+	}
+	lg.AddOrReplace(zoned, 3)
+	if got := lg.Snapshot(); len(got) != 1 || got[0].Item != 3 || got[0].Time.Location() != time.UTC {
+		t.Error("expected the item replaced at its original time, got", got)
+	}
+	if !lg.Remove(zoned) || lg.Len() != 0 {
+		t.Error("expected Remove to match across locations")
+	}
+	if _, err := lg.Add(zoned, 4); err != nil {
+		t.Error("expected the key freed by Remove, got", err)
+	}
+}
+
+// WithMaxFutureSkew refuses an item far ahead of the clock
+func TestWithMaxFutureSkew(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lg := MakeHistory[int](time.Minute, WithClock(clock), WithMaxFutureSkew(time.Second))
+	for i := 0; i < 5; i++ {
+		lg.Add(time.Unix(int64(990+i), 0), i)
+	}
+
+	if _, err := lg.Add(time.Unix(1000, 0).Add(365*24*time.Hour), 9); !errors.Is(err, ErrFuture) {
+		t.Error("expected future error, got", err)
+	}
+	if _, err := lg.AddOrReplace(time.Unix(1002, 0), 9); !errors.Is(err, ErrFuture) {
+		t.Error("expected AddOrReplace refused too, got", err)
+	}
+	if _, err := lg.Add(time.Unix(1001, 0), 5); err != nil || lg.Len() != 6 {
+		t.Error("expected an item within the skew stored, got", lg.Len(), err)
+	}
+}
+
+// WithIngestInterval keeps one item per interval from the newest
+func TestWithIngestInterval(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithIngestInterval(time.Second))
+	tm := time.Unix(100, 0)
+
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*300*time.Millisecond), i)
+	}
+	if got := lg.Snapshot(); len(got) != 3 || got[1].Item != 4 || got[2].Item != 8 {
+		t.Error("expected one item per second, got", got)
+	}
+	if e, err := lg.Add(tm.Add(2500*time.Millisecond), 10); err != nil || e.Item != 8 {
+		t.Error("expected a late Add near the newest dropped for it, got", e, err)
+	}
+	if _, err := lg.Add(tm.Add(500*time.Millisecond), 11); err != nil || lg.Len() != 4 {
+		t.Error("expected a late Add well before the newest stored, got", lg.Snapshot(), err)
+	}
+	if e, _ := lg.AddWithTTL(tm.Add(2600*time.Millisecond), 13, time.Hour); e.Item != 8 {
+		t.Error("expected AddWithTTL throttled, got", e)
+	}
+	if e, _ := lg.AddWeighted(tm.Add(2700*time.Millisecond), 14, 2); e.Item != 8 {
+		t.Error("expected AddWeighted throttled, got", e)
+	}
+	if e, _ := lg.AddTagged(tm.Add(2800*time.Millisecond), 15, nil); e.Item != 8 {
+		t.Error("expected AddTagged throttled, got", e)
+	}
+	lg.AddOrReplace(tm.Add(2500*time.Millisecond), 12)
+	if lg.Len() != 5 {
+		t.Error("expected AddOrReplace unaffected, got", lg.Snapshot())
+	}
+}
+
+// IsWarm once the items span length, however few there are
+func TestIsWarm(t *testing.T) {
+	lg := MakeHistory[int](time.Minute)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	if lg.IsWarm() {
+		t.Error("expected a single item not to be warm")
+	}
+	lg.Add(tm.Add(59*time.Second), 1)
+	if lg.IsWarm() {
+		t.Error("expected 59s not to be warm")
+	}
+	lg.Add(tm.Add(time.Minute), 2)
+	if !lg.IsWarm() {
+		t.Error("expected a minute to be warm")
+	}
+	if MakeHistory[int](0).IsWarm() {
+		t.Error("expected no length never to be warm")
+	}
+}
+
+// Repair rebuilds times from the map after Validate fails
+func TestRepair(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	lg.TrackSum(func(a int, b int) int { return a + b }, func(a int, b int) int { return a - b })
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if n := lg.Repair(); n != 0 {
+		t.Error("expected nothing to repair, got", n)
+	}
+
+	lg.times[1], lg.times[2] = lg.times[2], lg.times[1]
+	lg.times = append(lg.times, tm.Add(time.Hour))
+	delete(lg.t, lg.times[4])
+	lg.t[tm.Add(time.Minute)] = 10
+	if n := lg.Repair(); n != 4 {
+		t.Error("expected 4 discrepancies fixed, got", n)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Fatal("expected a valid History after Repair, got", err)
+	}
+	if got := lg.Snapshot(); len(got) != 5 || !got[4].Time.Equal(tm.Add(time.Minute)) {
+		t.Error("expected the map's items in order, got", got)
+	}
+	if s, _ := lg.TrailingSum(); s != 0+1+2+3+10 {
+		t.Error("expected the tracked sum recomputed, got", s)
+	}
+}
+
+// RangeInto gives the entries of Range in dst's memory
+func TestRangeInto(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	if _, err := lg.RangeInto(nil, tm, tm); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	dst := make([]Entry[int], 3, 8)
+	got, err := lg.RangeInto(dst, tm.Add(2*time.Second), tm.Add(6*time.Second))
+	want, _ := lg.Range(tm.Add(2*time.Second), tm.Add(6*time.Second))
+	if err != nil || !slices.Equal(got, want) || &got[0] != &dst[:1][0] {
+		t.Error("expected", want, "in dst, got", got, err)
+	}
+}
+
+// Shift moves items and their TTLs, expiring those moved past the clock
+func TestShift(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(100, 0)}
+	lg := MakeHistory[int](time.Hour, WithClock(clock))
+	tm := time.Unix(90, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	lg.AddWithTTL(tm.Add(5*time.Second), 5, 10*time.Second)
+
+	lg.Shift(time.Minute)
+	if err := lg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if it, ok := lg.Get(tm.Add(time.Minute + 2*time.Second)); !ok || it != 2 || lg.Len() != 6 {
+		t.Error("expected the items a minute later, got", lg.Snapshot())
+	}
+
+	lg.Shift(-2 * time.Minute)
+	if lg.Len() != 5 {
+		t.Error("expected the TTL item moved past the clock to expire, got", lg.Snapshot())
+	}
+	if _, ok := lg.Get(tm.Add(-time.Minute)); !ok {
+		t.Error("expected the oldest item a minute earlier")
+	}
+}
+
+// Seq wraps round to 1 after a lifetime of Adds, never giving 0
+func TestSeqWraps(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithSeq())
+	lg.lastSeq = math.MaxUint64 - 1
+	tm := time.Unix(0, 0)
+
+	var seqs []uint64
+	for i := 0; i < 3; i++ {
+		e, _ := lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+		seqs = append(seqs, e.Seq)
+	}
+	if !slices.Equal(seqs, []uint64{math.MaxUint64, 1, 2}) {
+		t.Error("expected the Seq to wrap past 0, got", seqs)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// DiffSince reports what was added and evicted since a Snapshot
+func TestDiffSince(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](5, WithSeq())
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	prev := lg.Snapshot()
+	if added, removed := lg.DiffSince(prev); len(added) != 0 || len(removed) != 0 {
+		t.Error("expected no changes, got", added, removed)
+	}
+
+	lg.Add(tm.Add(5*time.Second), 5)
+	lg.Add(tm.Add(6*time.Second), 6)
+	lg.AddOrReplace(tm.Add(3*time.Second), 30)
+	added, removed := lg.DiffSince(prev)
+	items := func(entries []Entry[int]) []int {
+		var got []int
+		for _, e := range entries {
+			got = append(got, e.Item)
+		}
+		return got
+	}
+	if !slices.Equal(items(added), []int{30, 5, 6}) || !slices.Equal(items(removed), []int{0, 1, 3}) {
+		t.Error("expected 30, 5, 6 added and 0, 1, 3 removed, got", added, removed)
+	}
+}
+
+// a History of pointers hands back the stored pointers, not copies
+func TestPointerItems(t *testing.T) {
+	lg := MakeHistory[*largeItem](time.Hour, WithItemSize(int(unsafe.Sizeof(largeItem{}))))
+	tm := time.Unix(0, 0)
+	it := &largeItem{}
+	lg.Add(tm, it)
+
+	entries, _ := lg.Range(tm, tm.Add(time.Second))
+	if len(entries) != 1 || entries[0].Item != it {
+		t.Error("expected the stored pointer back, got", entries)
+	}
+	if n := lg.ApproxBytes(); n < int(unsafe.Sizeof(largeItem{})) {
+		t.Error("expected the pointed to size counted, got", n)
+	}
+}
+
+// output order never depends on map iteration
+func TestDeterministicOrder(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithSeq())
+	tm := time.Unix(0, 0)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(200) {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i%7)
+	}
+	from, to := tm.Add(10*time.Second), tm.Add(150*time.Second)
+	key := func(it int) string { return strconv.Itoa(it % 3) }
+
+	run := func() string {
+		var b strings.Builder
+		r, _ := lg.Range(from, to)
+		d, _ := lg.RangeDesc(from, to)
+		g, _ := lg.GroupBy(from, to, key)
+		m, n, _ := lg.ModeBetween(from, to, key)
+		s, _ := lg.Sample(from, to, 10, rand.New(rand.NewSource(2)))
+		added, removed := lg.DiffSince(r)
+		fmt.Fprint(&b, r, d, lg.Snapshot(), lg.Tail(5), g["0"], g["1"], g["2"], m, n, s, added, removed)
+		return b.String()
+	}
+	want := run()
+	for i := 0; i < 50; i++ {
+		if got := run(); got != want {
+			t.Fatal("output changed between runs")
+		}
+	}
+}
+
+// At and IndexOf go between positions and times
+func TestAtIndexOf(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i*10)
+	}
+
+	if e, ok := lg.At(3); !ok || e.Item != 30 || !e.Time.Equal(tm.Add(3*time.Second)) {
+		t.Error("expected the fourth entry, got", e, ok)
+	}
+	for _, i := range []int{-1, 5} {
+		if _, ok := lg.At(i); ok {
+			t.Error("expected index", i, "out of range")
+		}
+	}
+	if i, ok := lg.IndexOf(tm.Add(2 * time.Second)); !ok || i != 2 {
+		t.Error("expected position 2, got", i, ok)
+	}
+	if _, ok := lg.IndexOf(tm.Add(2500 * time.Millisecond)); ok {
+		t.Error("expected no position between items")
+	}
+}
+
+// Chunks hands the window over in pieces, stopping at an error
+func TestChunks(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	var sizes []int
+	var items []int
+	err := lg.Chunks(tm.Add(time.Second), tm.Add(9*time.Second), 3, func(chunk []Entry[int]) error {
+		sizes = append(sizes, len(chunk))
+		for _, e := range chunk {
+			items = append(items, e.Item)
+		}
+		lg.Add(tm.Add(time.Hour), 99) // outside the window, and no deadlock
+		return nil
+	})
+	if err != nil || !slices.Equal(sizes, []int{3, 3, 2}) || !slices.Equal(items, []int{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Error("expected 1 to 8 in chunks of 3, got", sizes, items, err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := lg.Chunks(tm, tm.Add(9*time.Second), 2, func([]Entry[int]) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Error("expected the error to stop the walk, got", err, calls)
+	}
+	if err := lg.Chunks(tm, tm, 0, nil); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+}
+
+// AvgBetweenOr falls back only for an empty window
+func TestAvgBetweenOr(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 4)
+	lg.Add(tm.Add(time.Second), 8)
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	if avg, err := lg.AvgBetweenOr(tm, tm.Add(time.Minute), -1, sum, div); err != nil || avg != 6 {
+		t.Error("expected the average, got", avg, err)
+	}
+	if avg, err := lg.AvgBetweenOr(tm.Add(time.Hour), tm.Add(2*time.Hour), -1, sum, div); err != nil || avg != -1 {
+		t.Error("expected the fallback, got", avg, err)
+	}
+}
+
+// AvgBetweenWithProvenance names the entries averaged
+func TestAvgBetweenWithProvenance(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	avg, entries, err := lg.AvgBetweenWithProvenance(tm.Add(2*time.Second), tm.Add(5*time.Second), sum, div)
+	if err != nil || avg != 3 || len(entries) != 3 || entries[0].Item != 2 || entries[2].Item != 4 {
+		t.Error("expected 2, 3, 4 averaging 3, got", avg, entries, err)
+	}
+	if _, entries, err := lg.AvgBetweenWithProvenance(tm.Add(time.Hour), tm.Add(2*time.Hour), sum, div); !errors.Is(err, ErrNoValues) || len(entries) != 0 {
+		t.Error("expected no values and no entries, got", entries, err)
+	}
+}
+
+// an inconsistent state makes Add fail instead of panicking
+func TestAddInconsistent(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.times = append(lg.times, tm.Add(time.Second))
+
+	if _, err := lg.Add(tm.Add(time.Duration(2)*time.Second), 2); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected inconsistent error, got", err)
+	}
+	if _, err := lg.AddOrReplace(tm, 1); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected inconsistent error, got", err)
+	}
+
+	// the lock was released
+	if lg.Len() != 2 {
+		t.Error("length incorrect:", lg.Len())
+	}
+}
+
+// AddNow stamps items with the clock
+func TestAddNow(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	lg := MakeHistory[int](time.Duration(1)*time.Hour, WithClock(clock))
+
+	if _, err := lg.AddNow(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lg.AddNow(2); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+	clock.now = clock.now.Add(time.Second)
+	lg.AddNow(3)
+
+	if p, ti, _ := lg.Newest(); p != 3 || !ti.Equal(clock.now) {
+		t.Error("AddNow stored", p, ti)
+	}
+	if lg.Len() != 2 {
+		t.Error("length incorrect:", lg.Len())
+	}
+}
+
+// BeforeStrict gives no item before the start, Before the oldest
+func TestBeforeStrict(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	if _, _, err := lg.BeforeStrict(tm); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Minute), 2)
+
+	if p, then, err := lg.BeforeStrict(tm.Add(-time.Second)); !errors.Is(err, ErrBeforeStart) || p != 0 || !then.IsZero() {
+		t.Error("BeforeStrict before start got", p, then, err)
+	}
+	if p, _, err := lg.Before(tm.Add(-time.Second)); !errors.Is(err, ErrBeforeStart) || p != 1 {
+		t.Error("Before before start got", p, err)
+	}
+	if p, _, err := lg.BeforeStrict(tm.Add(90 * time.Second)); err != nil || p != 2 {
+		t.Error("BeforeStrict got", p, err)
+	}
+}
+
+// BeforeBatch answers as Before does for each time
+func TestBeforeBatch(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	if _, _, err := lg.BeforeBatch([]time.Time{tm}); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+	for i := 0; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	var wanted []time.Time
+	for q := -2; q < 220; q += 3 {
+		wanted = append(wanted, tm.Add(time.Duration(q)*time.Second/2))
+	}
+	items, times, err := lg.BeforeBatch(wanted)
+	if !errors.Is(err, ErrBeforeStart) || len(items) != len(wanted) {
+		t.Fatal("expected results with a before start error, got", len(items), err)
+	}
+	for k, w := range wanted {
+		it, then, _ := lg.Before(w)
+		if items[k] != it || !times[k].Equal(then) {
+			t.Error("at", w, "expected", it, "got", items[k])
+		}
+	}
+
+	if _, _, err := lg.BeforeBatch(wanted[1:]); err != nil {
+		t.Error("expected no error from the start on, got", err)
+	}
+}
+
+// BeforeWithin rejects matches older than maxAge
+func TestBeforeWithin(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.Add(tm.Add(time.Minute), 1)
+
+	if p, _, err := lg.BeforeWithin(tm.Add(time.Duration(70)*time.Second), time.Duration(10)*time.Second); err != nil || p != 1 {
+		t.Error("BeforeWithin fresh got", p, err)
+	}
+	if p, _, err := lg.BeforeWithin(tm.Add(time.Duration(71)*time.Second), time.Duration(10)*time.Second); !errors.Is(err, ErrStale) || p != 1 {
+		t.Error("BeforeWithin stale got", p, err)
+	}
+	if _, _, err := lg.BeforeWithin(tm.Add(-time.Second), time.Hour); !errors.Is(err, ErrBeforeStart) {
+		t.Error("BeforeWithin before start got", err)
+	}
+}
+
+// BeforeWithGap reports how far before wanted the match was logged
+func TestBeforeWithGap(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	if _, _, gap, err := lg.BeforeWithGap(tm); !errors.Is(err, ErrEmpty) || gap != 0 {
+		t.Error("BeforeWithGap on empty got", gap, err)
+	}
+	lg.Add(tm, 0)
+	lg.Add(tm.Add(time.Minute), 1)
+
+	if p, _, gap, err := lg.BeforeWithGap(tm.Add(time.Duration(70) * time.Second)); err != nil || p != 1 || gap != 10*time.Second {
+		t.Error("BeforeWithGap got", p, gap, err)
+	}
+	if p, _, gap, err := lg.BeforeWithGap(tm.Add(time.Minute)); err != nil || p != 1 || gap != 0 {
+		t.Error("BeforeWithGap at an item got", p, gap, err)
+	}
+	if _, _, gap, err := lg.BeforeWithGap(tm.Add(-time.Second)); !errors.Is(err, ErrBeforeStart) || gap != -time.Second {
+		t.Error("BeforeWithGap before start got", gap, err)
+	}
+}
+
+// Interpolate blends the items around the wanted time
+func TestInterpolate(t *testing.T) {
+	lg := MakeHistory[float64](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	lerp := func(a float64, b float64, frac float64) float64 { return a + (b-a)*frac }
+
+	if _, err := lg.Interpolate(tm, lerp); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+
+	lg.Add(tm, 10)
+	lg.Add(tm.Add(time.Duration(4)*time.Second), 30)
+
+	if v, err := lg.Interpolate(tm.Add(time.Second), lerp); err != nil || v != 15 {
+		t.Error("Interpolate got", v, "expected 15", err)
+	}
+	if v, err := lg.Interpolate(tm.Add(time.Duration(4)*time.Second), lerp); err != nil || v != 30 {
+		t.Error("Interpolate on item got", v, "expected 30", err)
+	}
+	if v, err := lg.Interpolate(tm.Add(-time.Second), lerp); !errors.Is(err, ErrBeforeStart) || v != 10 {
+		t.Error("Interpolate before start got", v, err)
+	}
+	if v, err := lg.Interpolate(tm.Add(time.Minute), lerp); !errors.Is(err, ErrAfterEnd) || v != 30 {
+		t.Error("Interpolate after end got", v, err)
+	}
+}
+
+// Add returns the stored entry
+func TestAddReturnsEntry(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+
+	e, err := lg.Add(tm, 1)
+	if err != nil || e.Item != 1 || !e.Time.Equal(tm) {
+		t.Error("Add returned", e, err)
+	}
+	if e, err = lg.AddOrReplace(tm, 2); err != nil || e.Item != 2 {
+		t.Error("AddOrReplace returned", e, err)
+	}
+	if !lg.Remove(e.Time) || lg.Len() != 0 {
+		t.Error("entry time did not identify the entry")
+	}
+
+	if _, err := lg.ItemsBetween(tm, tm.Add(time.Second)); err != nil {
+		t.Error("ItemsBetween on empty log:", err)
+	}
+}
+
+// the tracked total follows adds, replacements, evictions and removals
+func TestTrackSum(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](5)
+	tm := time.Unix(0, 0)
+	sum := func(a int, b int) int { return a + b }
+	sub := func(a int, b int) int { return a - b }
+	div := func(a int, n int) int { return a / n }
+
+	if _, err := lg.TrailingAvg(div); !errors.Is(err, ErrNotTracked) {
+		t.Error("expected not tracked error, got", err)
+	}
+
+	lg.Add(tm, 100)
+	lg.TrackSum(sum, sub)
+	for i := 1; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if s, ok := lg.TrailingSum(); !ok || s != 5+6+7+8+9 {
+		t.Error("TrailingSum got", s, ok, "expected 35")
+	}
+
+	lg.AddOrReplace(tm.Add(time.Duration(9)*time.Second), 19)
+	lg.Remove(tm.Add(time.Duration(5) * time.Second))
+	if avg, err := lg.TrailingAvg(div); err != nil || avg != (6+7+8+19)/4 {
+		t.Error("TrailingAvg got", avg, err)
+	}
+
+	lg.Clear()
+	if s, _ := lg.TrailingSum(); s != 0 {
+		t.Error("TrailingSum after Clear got", s)
+	}
+	if _, err := lg.TrailingAvg(div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// Head and Tail return the ends in time order
+func TestHeadTail(t *testing.T) {
+	lg := MakeHistory[int](time.Duration(1) * time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	items := func(entries []Entry[int]) []int {
+		its := make([]int, len(entries))
+		for i, e := range entries {
+			its[i] = e.Item
+		}
+		return its
+	}
+
+	if got := items(lg.Tail(2)); !slices.Equal(got, []int{3, 4}) {
+		t.Error("Tail(2) got", got)
+	}
+	if got := items(lg.Head(2)); !slices.Equal(got, []int{0, 1}) {
+		t.Error("Head(2) got", got)
+	}
+	if got := items(lg.Tail(10)); len(got) != 5 {
+		t.Error("Tail(10) got", got)
+	}
+	if len(lg.Head(-1)) != 0 || len(lg.Tail(0)) != 0 {
+		t.Error("non-positive n returned entries")
+	}
+}
+
+// the backing array of times stays bounded under steady add and evict
+func TestCompact(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](100)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 100000; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Millisecond), i)
+		if c := cap(lg.times) + lg.trimmed; c > 400 {
+			t.Fatal("backing array grew to", c, "after", i, "adds")
+		}
+	}
+
+	lg.UpdateCapacity(0)
+	for i := 100000; i < 110000; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Millisecond), i)
+	}
+	lg.RemoveBefore(tm.Add(time.Duration(109990) * time.Millisecond))
+	if cap(lg.times)+lg.trimmed > 40 {
+		t.Error("backing array kept after RemoveBefore:", cap(lg.times), lg.trimmed)
+	}
+
+	lg.Compact()
+	if cap(lg.times) != 10 || len(lg.t) != 10 || lg.trimmed != 0 {
+		t.Error("Compact left", cap(lg.times), len(lg.t), lg.trimmed)
+	}
+	if p, _, _ := lg.Oldest(); p != 109990 {
+		t.Error("Compact lost items, oldest is", p)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Fatal("valid History failed:", err)
+	}
+
+	lg.times[1], lg.times[2] = lg.times[2], lg.times[1]
+	if err := lg.Validate(); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected unsorted times to fail, got", err)
+	}
+	lg.times[1], lg.times[2] = lg.times[2], lg.times[1]
+
+	delete(lg.t, lg.times[3])
+	lg.t[tm.Add(time.Minute)] = 3
+	if err := lg.Validate(); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected missing key to fail, got", err)
+	}
+
+	lg.times = lg.times[:4]
+	if err := lg.Validate(); !errors.Is(err, ErrInconsistent) {
+		t.Error("expected length mismatch to fail, got", err)
+	}
+}
+
+func TestAvgBetweenFold(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []float64{4, -2, 7, 1} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	end := tm.Add(time.Minute)
+
+	avg, err := lg.AvgBetweenFold(tm, end,
+		func(running float64, next float64, i int) float64 { return running + next },
+		func(running float64, count int) float64 { return running / float64(count) })
+	if err != nil || avg != 2.5 {
+		t.Error("expected avg 2.5, got", avg, err)
+	}
+
+	positions := []int{}
+	low, err := lg.AvgBetweenFold(tm, end,
+		func(running float64, next float64, i int) float64 {
+			positions = append(positions, i)
+			return min(running, next)
+		},
+		func(running float64, count int) float64 { return running })
+	if err != nil || low != -2 {
+		t.Error("expected min -2, got", low, err)
+	}
+	if !slices.Equal(positions, []int{1, 2, 3}) {
+		t.Error("unexpected positions", positions)
+	}
+
+	if _, err := lg.AvgBetweenFold(end, end.Add(time.Minute), nil, nil); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// a non-positive length keeps everything, up to capacity if set
+func TestUnboundedLength(t *testing.T) {
+	tm := time.Unix(0, 0)
+	for _, d := range []time.Duration{0, -time.Second} {
+		lg := MakeHistoryWithMin[int](d, 0)
+		for i := 0; i < 500; i++ {
+			lg.Add(tm.Add(time.Duration(i)*time.Hour), i)
+		}
+		if lg.Len() != 500 {
+			t.Error("length", d, "evicted down to", lg.Len())
+		}
+	}
+
+	lg := MakeHistoryWithMin[int](time.Second, 0)
+	lg.UpdateDuration(0)
+	lg.UpdateCapacity(10)
+	for i := 0; i < 50; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Hour), i)
+	}
+	if lg.Len() != 10 {
+		t.Error("expected capacity to still apply, got", lg.Len())
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Hour, 0)
+	tm := time.Unix(0, 0)
+	lg.Add(tm.Add(time.Duration(2)*time.Second), 2)
+
+	batch := []Entry[int]{
+		{Time: tm.Add(time.Duration(3) * time.Second), Item: 3},
+		{Time: tm, Item: 0},
+		{Time: tm.Add(time.Duration(2) * time.Second), Item: -2},
+		{Time: tm.Add(time.Second), Item: 1},
+		{Time: tm, Item: -1},
+	}
+	if err := lg.AddBatch(batch); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+	if batch[0].Item != 3 {
+		t.Error("AddBatch reordered the caller's slice")
+	}
+
+	want := []Entry[int]{}
+	for i := 0; i < 4; i++ {
+		want = append(want, Entry[int]{Time: tm.Add(time.Duration(i) * time.Second), Item: i})
+	}
+	if got := lg.Snapshot(); !slices.Equal(got, want) {
+		t.Error("expected", want, "got", got)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	lg.UpdateCapacity(3)
+	if err := lg.AddBatch([]Entry[int]{{Time: tm.Add(time.Minute), Item: 60}}); err != nil {
+		t.Error(err)
+	}
+	if lg.Len() != 3 {
+		t.Error("expected eviction to capacity, got", lg.Len())
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	tm := time.Unix(0, 0)
+	batch := make([]Entry[int], 10000)
+	for i := range batch {
+		batch[i] = Entry[int]{Time: tm.Add(time.Duration(i) * time.Second), Item: i}
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg := MakeHistory[int](time.Hour)
+		lg.AddBatch(batch)
+	}
+}
+
+// the descending walks select the same window as Range, reversed
+func TestRangeDesc(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithBounds(Closed))
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	from, to := tm.Add(time.Duration(2)*time.Second), tm.Add(time.Duration(6)*time.Second)
+
+	asc, _ := lg.Range(from, to)
+	desc, err := lg.RangeDesc(from, to)
+	slices.Reverse(asc)
+	if err != nil || !slices.Equal(asc, desc) {
+		t.Error("expected", asc, "got", desc, err)
+	}
+
+	seen := []int{}
+	lg.ForEachDesc(from, to, func(ti time.Time, it int) bool {
+		seen = append(seen, it)
+		return it > 4
+	})
+	if !slices.Equal(seen, []int{6, 5, 4}) {
+		t.Error("ForEachDesc visited", seen)
+	}
+
+	if _, err := MakeHistory[int](time.Hour).RangeDesc(from, to); !errors.Is(err, ErrEmpty) {
+		t.Error("expected empty error, got", err)
+	}
+}
+
+// the Since helpers anchor their window at the clock's now
+func TestSince(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm.Add(time.Duration(10) * time.Second)}
+	lg := MakeHistory[int](time.Hour, WithClock(clock))
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	// [now-4s, now) holds 6 to 9
+	if n, err := lg.CountSince(time.Duration(4) * time.Second); err != nil || n != 4 {
+		t.Error("expected 4 items, got", n, err)
+	}
+	entries, err := lg.RangeSince(time.Duration(4) * time.Second)
+	if err != nil || len(entries) != 4 || entries[0].Item != 6 {
+		t.Error("unexpected range", entries, err)
+	}
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	if avg, err := lg.AvgSince(time.Duration(3)*time.Second, sum, div); err != nil || avg != 8 {
+		t.Error("expected avg 8, got", avg, err)
+	}
+
+	clock.now = tm.Add(time.Minute)
+	if _, err := lg.AvgSince(time.Second, sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+// with Coalesce only changes of value are stored
+func TestCoalesce(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	lg.Coalesce(func(a int, b int) bool { return a == b }, time.Minute)
+	tm := time.Unix(0, 0)
+
+	for i, v := range []int{1, 1, 1, 2, 2, 1} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	if lg.Len() != 3 {
+		t.Error("expected 3 changes stored, got", lg.Snapshot())
+	}
+	if it, then, _ := lg.Before(tm.Add(time.Duration(2) * time.Second)); it != 1 || !then.Equal(tm) {
+		t.Error("expected the value last changed to, got", it, then)
+	}
+
+	// a repeat after minInterval is stored again
+	e, err := lg.Add(tm.Add(time.Duration(5)*time.Second+time.Minute), 1)
+	if err != nil || lg.Len() != 4 || !e.Time.Equal(tm.Add(time.Duration(5)*time.Second+time.Minute)) {
+		t.Error("expected the repeat stored, got", e, err, lg.Len())
+	}
+	e, _ = lg.Add(tm.Add(time.Duration(6)*time.Second+time.Minute), 1)
+	if !e.Time.Equal(tm.Add(time.Duration(5)*time.Second + time.Minute)) {
+		t.Error("expected the previous entry back, got", e)
+	}
+
+	lg.Coalesce(nil, 0)
+	lg.Add(tm.Add(time.Duration(7)*time.Second+time.Minute), 1)
+	if lg.Len() != 5 {
+		t.Error("expected every item stored with Coalesce off, got", lg.Len())
+	}
+}
+
+func TestFind(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i, v := range []int{1, 5, 2, 7, 3, 8} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	over := func(it int) bool { return it > 4 }
+	end := tm.Add(time.Duration(5) * time.Second)
+
+	if it, then, ok := lg.FindFirst(tm, end, over); !ok || it != 5 || !then.Equal(tm.Add(time.Second)) {
+		t.Error("expected 5 at 1s, got", it, then, ok)
+	}
+	// the window [0s, 5s) leaves out the 8
+	if it, then, ok := lg.FindLast(tm, end, over); !ok || it != 7 || !then.Equal(tm.Add(time.Duration(3)*time.Second)) {
+		t.Error("expected 7 at 3s, got", it, then, ok)
+	}
+	if _, _, ok := lg.FindLast(tm, end, func(it int) bool { return it > 10 }); ok {
+		t.Error("expected no match")
+	}
+}
+
+// Trim evicts by the clock's now rather than the newest item
+func TestTrim(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistoryWithMin[int](time.Duration(10)*time.Second, 2, WithClock(clock))
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	clock.now = tm.Add(time.Duration(15) * time.Second)
+	if n := lg.Trim(); n != 5 || lg.Len() != 5 {
+		t.Error("expected 5 trimmed, got", n, lg.Len())
+	}
+	clock.now = tm.Add(time.Hour)
+	if n := lg.Trim(); n != 3 || lg.Len() != 2 {
+		t.Error("expected trimming to stop at minKeep, got", n, lg.Len())
+	}
+}
+
+// Tick evicts by the clock without an Add, keeps minKeep and frees slack
+func TestTick(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistoryWithMin[int](time.Duration(10)*time.Second, 2, WithClock(clock))
+	evicted := 0
+	lg.OnEvict(func(t time.Time, it int) { evicted++ })
+	for i := 0; i < 100; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second/10), i)
+	}
+	if n := lg.Tick(); n != 0 || lg.Len() != 100 {
+		t.Error("expected nothing to go before the clock moves, got", n, lg.Len())
+	}
+
+	clock.now = tm.Add(time.Duration(15) * time.Second)
+	if n := lg.Tick(); n != 50 || lg.Len() != 50 || evicted != 50 {
+		t.Error("expected 50 ticked away, got", n, lg.Len(), evicted)
+	}
+	if c := cap(lg.times); c != 50 {
+		t.Error("expected times compacted to 50, got cap", c)
+	}
+	if d := lg.Diagnostics(); d.LastEvicted != 50 {
+		t.Error("expected LastEvicted 50, got", d.LastEvicted)
+	}
+	clock.now = tm.Add(time.Hour)
+	if n := lg.Tick(); n != 48 || lg.Len() != 2 {
+		t.Error("expected ticking to stop at minKeep, got", n, lg.Len())
+	}
+}
+
+// Tick keeps the room WithInitialCapacity made and reports one pass
+func TestTickInitialCapacity(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	obs := &countingObserver{}
+	lg := MakeHistoryWithMin[int](time.Minute, 0, WithClock(clock), WithInitialCapacity(1000), WithObserver(obs))
+	for i := 0; i < 10; i++ {
+		lg.Add(seconds(tm, i), i)
+	}
+
+	obs.evicts = nil
+	clock.now = seconds(tm, 65)
+	if n := lg.Tick(); n != 5 || lg.Len() != 5 {
+		t.Error("expected 5 ticked away, got", n, lg.Len())
+	}
+	if c := cap(lg.times); c < 995 {
+		t.Error("expected the initial capacity kept, got cap", c)
+	}
+	if !slices.Equal(obs.evicts, []int{5}) {
+		t.Error("expected one eviction pass of 5 observed, got", obs.evicts)
+	}
+}
+
+func TestAutoTrim(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistoryWithMin[int](time.Duration(10)*time.Second, 0, WithClock(clock), WithAutoTrim())
+	evicted := 0
+	lg.OnEvict(func(t time.Time, it int) { evicted++ })
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	clock.now = tm.Add(time.Duration(18) * time.Second)
+	if lg.Len() != 2 || evicted != 8 {
+		t.Error("expected a read to trim to 2 items, got", lg.Len(), evicted)
+	}
+	if _, _, err := lg.Before(tm.Add(time.Duration(5) * time.Second)); !errors.Is(err, ErrBeforeStart) {
+		t.Error("expected trimmed items gone, got", err)
+	}
+}
+
+// contention benchmarks: adds all take the write lock, reads share the
+// read lock but hold off adds for as long as they scan
+func BenchmarkAddParallel(b *testing.B) {
+	lg := MakeHistoryWithCapacity[int](10000)
+	var n atomic.Int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lg.Add(time.Unix(0, n.Add(1)), 0)
+		}
+	})
+}
+
+func BenchmarkReadParallel(b *testing.B) {
+	lg, from, to := benchHistory()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lg.NumItemsBetween(from, to)
+		}
+	})
+}
+
+// parallel window averages with one goroutine adding throughout
+func BenchmarkReadWhileAdding(b *testing.B) {
+	lg, from, to := benchHistory()
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	done := make(chan struct{})
+	go func() {
+		for i := int64(10000); ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				lg.Add(time.Unix(0, i), 0)
+			}
+		}
+	}()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			lg.AvgBetween(from, to, sum, div)
+		}
+	})
+	close(done)
+}
+
+func BenchmarkRange(b *testing.B) {
+	lg, from, to := benchHistory()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Range(from, to)
+	}
+}
+
+// reusing the last result, allocation free once it has grown to the window
+func BenchmarkRangeInto(b *testing.B) {
+	lg, from, to := benchHistory()
+	var dst []Entry[int]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dst, _ = lg.RangeInto(dst, from, to)
+	}
+}
+
+// an item big enough for copying it to dominate
+type largeItem struct {
+	values [64]int64
+}
+
+// Range over large items by value and by pointer
+func BenchmarkRangeLarge(b *testing.B) {
+	b.Run("value", func(b *testing.B) {
+		lg := MakeHistory[largeItem](time.Hour)
+		for i := 0; i < 1000; i++ {
+			lg.Add(time.Unix(0, int64(i)), largeItem{})
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			lg.Range(time.Unix(0, 0), time.Unix(0, 1000))
+		}
+	})
+	b.Run("pointer", func(b *testing.B) {
+		lg := MakeHistory[*largeItem](time.Hour)
+		for i := 0; i < 1000; i++ {
+			lg.Add(time.Unix(0, int64(i)), &largeItem{})
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			lg.Range(time.Unix(0, 0), time.Unix(0, 1000))
+		}
+	})
+}
+
+func benchHistory() (*History[int], time.Time, time.Time) {
+	lg := MakeHistoryWithCapacity[int](10000)
+	for i := 0; i < 10000; i++ {
+		lg.Add(time.Unix(0, int64(i)), i)
+	}
+	return lg, time.Unix(0, 1000), time.Unix(0, 2000)
+}
+
+func TestString(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	if s := lg.String(); s != "History(len=0)" {
+		t.Error("unexpected empty summary", s)
+	}
+	tm := time.Unix(0, 0).UTC()
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Duration(90)*time.Second), 2)
+	want := "History(len=2, span=1m30s, oldest=1970-01-01T00:00:00Z, newest=1970-01-01T00:01:30Z)"
+	if s := fmt.Sprint(lg); s != want {
+		t.Error("expected", want, "got", s)
+	}
+}
+
+type countingObserver struct {
+	adds    int
+	evicts  []int
+	lookups int
+}
+
+func (o *countingObserver) ObserveAdd()                   { o.adds++ }
+func (o *countingObserver) ObserveEvict(n int)            { o.evicts = append(o.evicts, n) }
+func (o *countingObserver) ObserveLookup(d time.Duration) { o.lookups++ }
+
+func TestObserver(t *testing.T) {
+	obs := &countingObserver{}
+	lg := MakeHistoryWithCapacity[int](2, WithObserver(obs))
+	tm := time.Unix(0, 0)
+	for i := 0; i < 3; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	lg.Before(tm.Add(time.Second))
+	lg.After(tm)
+
+	if obs.adds != 3 || !slices.Equal(obs.evicts, []int{0, 0, 1}) || obs.lookups != 2 {
+		t.Error("unexpected observations", obs)
+	}
+}
+
+func TestRejectEvicted(t *testing.T) {
+	tm := time.Unix(0, 0)
+	lg := MakeHistoryWithMin[int](time.Duration(10)*time.Second, 2, WithRejectEvicted())
+	lg.Add(tm.Add(time.Minute), 0)
+
+	// below minKeep an old item is still kept
+	if _, err := lg.Add(tm, 1); err != nil {
+		t.Error("expected the item kept under minKeep, got", err)
+	}
+	if _, err := lg.Add(tm.Add(time.Second), 2); !errors.Is(err, ErrTooOld) {
+		t.Error("expected too old error, got", err)
+	}
+	// storing a recent item evicts the one kept under minKeep
+	if _, err := lg.Add(tm.Add(time.Duration(55)*time.Second), 3); err != nil || lg.Len() != 2 {
+		t.Error("expected a recent item stored, got", err, lg.Len())
+	}
+
+	capped := MakeHistoryWithCapacity[int](2, WithRejectEvicted())
+	capped.Add(tm.Add(time.Second), 0)
+	capped.Add(tm.Add(time.Duration(2)*time.Second), 0)
+	if _, err := capped.Add(tm, 0); !errors.Is(err, ErrTooOld) {
+		t.Error("expected too old error at capacity, got", err)
+	}
+}
+
+// paging through a window returns every entry once, in order
+func TestRangePage(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	from, to := tm.Add(time.Second), tm.Add(time.Duration(9)*time.Second)
+
+	seen := []int{}
+	var cursor time.Time
+	for pages := 0; ; pages++ {
+		page, next, err := lg.RangePage(from, to, cursor, 3)
+		if err != nil || pages > 5 {
+			t.Fatal("paging failed", err, pages)
+		}
+		for _, e := range page {
+			seen = append(seen, e.Item)
+		}
+		if len(page) < 3 {
+			break
+		}
+		cursor = next
+		if pages == 0 {
+			// lands after the cursor, so the next page picks it up
+			lg.Add(tm.Add(time.Duration(4500)*time.Millisecond), 45)
+		}
+	}
+	if !slices.Equal(seen, []int{1, 2, 3, 4, 45, 5, 6, 7, 8}) {
+		t.Error("unexpected pages", seen)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Hour, 5)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	eq := func(a int, b int) bool { return a == b }
+
+	c := lg.Clone()
+	if !lg.Equal(c, eq) || !c.Equal(lg, eq) || !lg.Equal(lg, eq) {
+		t.Error("expected a clone to be equal")
+	}
+	// the same instant in another location is equal
+	c.Remove(tm)
+	c.Add(tm.In(time.FixedZone("X", 3600)), 0)
+	if !lg.Equal(c, eq) {
+		t.Error("expected equal instants to compare equal")
+	}
+
+	c.AddOrReplace(tm.Add(time.Second), 100)
+	if lg.Equal(c, eq) {
+		t.Error("expected a changed item to differ")
+	}
+	c = lg.Clone()
+	c.UpdateMinKeep(1)
+	if lg.Equal(c, eq) {
+		t.Error("expected a changed minKeep to differ")
+	}
+}
+
+func TestGet(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Second), 2)
+
+	if it, ok := lg.Get(tm.Add(time.Second)); !ok || it != 2 {
+		t.Error("expected 2, got", it, ok)
+	}
+	if _, ok := lg.Get(tm.Add(time.Millisecond)); ok {
+		t.Error("expected no item between the stored times")
+	}
+}
+
+// EvictIf drops matching entries anywhere in the log, down to minKeep
+func TestEvictIf(t *testing.T) {
+	lg := MakeHistoryWithMin[int](time.Hour, 3)
+	tm := time.Unix(0, 0)
+	evicted := []int{}
+	lg.OnEvict(func(t time.Time, it int) { evicted = append(evicted, it) })
+	lg.EvictIf(func(t time.Time, it int) bool { return it < 0 })
+
+	for i, v := range []int{-1, 1, -2, 2, -3} {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	// -1 and -2 go, -3 stays as the third of minKeep
+	got := []int{}
+	for _, e := range lg.Snapshot() {
+		got = append(got, e.Item)
+	}
+	if !slices.Equal(got, []int{1, 2, -3}) || !slices.Equal(evicted, []int{-1, -2}) {
+		t.Error("unexpected entries", got, "evicted", evicted)
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	lg.Add(tm.Add(time.Duration(5)*time.Second), 3)
+	if it, _, _ := lg.Oldest(); it != 1 || lg.Len() != 3 {
+		t.Error("expected -3 evicted above minKeep, got", lg.Snapshot())
+	}
+}
+
+func TestCompareWindows(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm.Add(time.Duration(10) * time.Second)}
+	lg := MakeHistory[int](time.Hour, WithClock(clock))
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+
+	// [6s, 10s) against [2s, 6s)
+	cur, prev, err := lg.CompareWindows(time.Duration(4)*time.Second, time.Duration(4)*time.Second, sum, div)
+	if err != nil || cur != 7 || prev != 3 {
+		t.Error("expected 7 and 3, got", cur, prev, err)
+	}
+	if _, _, err := lg.CompareWindows(time.Second, time.Minute, sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistory[int](time.Hour, WithClock(clock))
+	if _, ok := lg.Age(); ok || lg.IsFresh(time.Hour) {
+		t.Error("expected an empty log to have no age and not be fresh")
+	}
+
+	lg.AddNow(1)
+	clock.now = tm.Add(time.Duration(30) * time.Second)
+	if age, ok := lg.Age(); !ok || age != time.Duration(30)*time.Second {
+		t.Error("expected age 30s, got", age, ok)
+	}
+	if !lg.IsFresh(time.Minute) || lg.IsFresh(time.Second) {
+		t.Error("unexpected freshness")
+	}
+}
+
+// a time from time.Now and its wall clock copy are the same key
+func TestMonotonicKeys(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	now := time.Now()
+	wall, err := time.Parse(time.RFC3339Nano, now.Format(time.RFC3339Nano))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wall = wall.In(now.Location())
+
+	e, _ := lg.Add(now, 1)
+	if e.Time != now.Round(0) {
+		t.Error("expected the monotonic reading stripped, got", e.Time)
+	}
+	if it, ok := lg.Get(wall); !ok || it != 1 {
+		t.Error("Get by the parsed time failed", it, ok)
+	}
+	if _, err := lg.Add(wall, 2); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected the parsed time to be a duplicate, got", err)
+	}
+	if it, _, err := lg.Before(wall); err != nil || it != 1 {
+		t.Error("Before the parsed time failed", it, err)
+	}
+
+	lg.Add(time.Now(), 3)
+	if it, ok := lg.Get(now); !ok || it != 1 {
+		t.Error("Get by the monotonic time failed", it, ok)
+	}
+	if !lg.Remove(wall) || lg.Len() != 1 {
+		t.Error("Remove by the parsed time failed")
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Before includes an item stored exactly at the wanted time
+func TestBeforeAtOrBefore(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 20; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	tests := []struct {
+		name   string
+		wanted time.Time
+		item   int
+		err    error
+	}{
+		{"first", tm, 0, nil},
+		{"last", tm.Add(time.Duration(19) * time.Second), 19, nil},
+		{"middle", tm.Add(time.Duration(7) * time.Second), 7, nil},
+		{"between", tm.Add(time.Duration(7500) * time.Millisecond), 7, nil},
+		{"just before a key", tm.Add(time.Duration(8)*time.Second - time.Nanosecond), 7, nil},
+		{"after last", tm.Add(time.Hour), 19, nil},
+		{"before first", tm.Add(-time.Nanosecond), 0, ErrBeforeStart},
+	}
+	for _, tt := range tests {
+		it, then, err := lg.Before(tt.wanted)
+		if it != tt.item || !errors.Is(err, tt.err) {
+			t.Error(tt.name, "expected", tt.item, tt.err, "got", it, err)
+		}
+		if tt.err == nil && (then.After(tt.wanted) || !then.Equal(tm.Add(time.Duration(it)*time.Second))) {
+			t.Error(tt.name, "unexpected time", then)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	lg := MakeHistoryWithMin[int](time.Second, 2, WithLogger(logger))
+	tm := time.Unix(0, 0)
+
+	lg.Add(tm.Add(time.Minute), 0)
+	lg.Add(tm.Add(time.Minute), 0)
+	lg.Add(tm, 1)
+	lg.Add(tm.Add(time.Duration(2)*time.Minute), 2)
+	lg.Add(tm.Add(time.Duration(3)*time.Minute), 3)
+
+	out := buf.String()
+	for _, msg := range []string{"duplicate timestamp", "out of order insert", "minKeep holds items older than length"} {
+		if strings.Count(out, msg) != 1 {
+			t.Errorf("expected %q logged once in %s", msg, out)
+		}
+	}
+}
@@ -6,7 +6,12 @@ import (
 
 type HistoryItem interface{}
 
-type HistoryItemWithTime struct {
-	Time time.Time   // time associated with item
-	Item HistoryItem // item
+type HistoryItemWithTime = Entry[HistoryItem]
+
+// an item and the time it is stored at. as a History holds at most one
+// item per time, Time identifies the entry, for example to Remove it.
+type Entry[T any] struct {
+	Time time.Time `json:"time"`          // time associated with item
+	Item T         `json:"item"`          // item
+	Seq  uint64    `json:"seq,omitempty"` // order the item was stored in with WithSeq, 0 without
 }
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"maps"
+	"time"
+)
+
+// Add for an item of one of several series kept in the same History, told
+// apart by labels, which the Matching methods filter on. labels are copied,
+// costing a map per tagged item on top of the item, so for many items
+// sharing few label sets separate Histories take less memory. items stored
+// any other way have nil labels, and replacing an item drops its labels.
+// labels are not kept by the encoders.
+func (l *History[T]) AddTagged(t time.Time, it T, labels map[string]string) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	e, kept, err := l.insert("AddTagged", l.stored(l.stamp(t)), it)
+	if kept && labels != nil {
+		if l.labels == nil {
+			l.labels = make(map[time.Time]map[string]string)
+		}
+		l.labels[e.Time] = maps.Clone(labels)
+	}
+	return e, err
+}
+
+// copy of the labels of the item stored at exactly t, nil if it has none,
+// and whether an item is stored there
+func (l *History[T]) Labels(t time.Time) (map[string]string, bool) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	t = l.stored(key(t))
+	_, ok := l.t[t]
+	return maps.Clone(l.labels[t]), ok
+}
+
+// Range of only the entries whose labels match, nil labels for untagged
+// items. match must not keep or change the labels.
+func (l *History[T]) RangeMatching(from time.Time, to time.Time, match func(labels map[string]string) bool) (_ []Entry[T], err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	var entries []Entry[T]
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		if match(l.labels[t]) {
+			entries = append(entries, l.entryAt(t))
+		}
+	}
+	return entries, nil
+}
+
+// AvgBetween of only the items whose labels match, as in RangeMatching
+func (l *History[T]) AvgBetweenMatching(
+	from time.Time,
+	to time.Time,
+	match func(labels map[string]string) bool,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (_ T, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var cum T
+	count := 0
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		if match(l.labels[t]) {
+			cum = sum(cum, l.t[t])
+			count++
+		}
+	}
+
+	if count == 0 {
+		var zero T
+		return zero, ErrNoValues
+	}
+	return div(cum, count), nil
+}
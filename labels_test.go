@@ -0,0 +1,55 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// the Matching methods pick one series out of several, untagged items
+// matching on nil labels
+func TestAddTagged(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	labels := map[string]string{"host": "a"}
+	lg.AddTagged(tm, 1, labels)
+	lg.AddTagged(tm.Add(time.Second), 10, map[string]string{"host": "b"})
+	lg.AddTagged(tm.Add(2*time.Second), 3, map[string]string{"host": "a"})
+	lg.Add(tm.Add(3*time.Second), 100)
+	labels["host"] = "c"
+
+	hostA := func(labels map[string]string) bool { return labels["host"] == "a" }
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	if avg, err := lg.AvgBetweenMatching(tm, tm.Add(time.Minute), hostA, sum, div); err != nil || avg != 2 {
+		t.Error("expected the labels copied and host a averaged, got", avg, err)
+	}
+	untagged := func(labels map[string]string) bool { return labels == nil }
+	if entries, err := lg.RangeMatching(tm, tm.Add(time.Minute), untagged); err != nil || len(entries) != 1 || entries[0].Item != 100 {
+		t.Error("expected the untagged item, got", entries, err)
+	}
+	if _, err := lg.AvgBetweenMatching(tm, tm.Add(time.Minute), func(map[string]string) bool { return false }, sum, div); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values, got", err)
+	}
+
+	lg.AddOrReplace(tm, 5)
+	if labels, ok := lg.Labels(tm); !ok || labels != nil {
+		t.Error("expected a replaced item to lose its labels, got", labels, ok)
+	}
+	if labels, ok := lg.Labels(tm.Add(time.Second)); !ok || labels["host"] != "b" {
+		t.Error("unexpected labels", labels, ok)
+	}
+}
+
+// WithRecover covers a panicking matcher
+func TestRangeMatchingRecover(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithRecover())
+	tm := time.Unix(0, 0)
+	lg.AddTagged(tm, 1, map[string]string{"host": "a"})
+	if _, err := lg.RangeMatching(tm, tm.Add(time.Minute), func(map[string]string) bool { panic("bad matcher") }); !errors.Is(err, ErrPanic) {
+		t.Error("expected panic error, got", err)
+	}
+	if _, err := lg.Add(tm.Add(time.Second), 2); err != nil {
+		t.Error("expected the lock released, got", err)
+	}
+}
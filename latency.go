@@ -0,0 +1,95 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// upper bounds of the first buckets of LatencyStats, the last bucket
+// counting everything slower
+var latencyBounds = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// durations of one operation recorded with WithOpLatencies
+type LatencyStats struct {
+	Count int           // calls timed
+	Total time.Duration // summed over the calls
+	Max   time.Duration // slowest call
+	// calls by duration: up to 1µs, 10µs, 100µs, 1ms, 10ms, 100ms and slower
+	Buckets [len(latencyBounds) + 1]int
+}
+
+// average duration of a call, 0 before any
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// LatencyStats by operation, with its own lock as readers record into it
+// concurrently under the shared read lock
+type latencies struct {
+	mux sync.Mutex
+	ops map[string]*LatencyStats
+}
+
+// time the main reads and writes of the History into a histogram per
+// operation read back with OpLatencies, to tell when a History has grown
+// big enough to slow queries down. timed are Add, AddNow, AddWithTTL,
+// AddWeighted, AddTagged, AddOrReplace, AddBatch, Get, Before, After,
+// Nearest, Range, AvgBetween and Fold, which SumBetween, MinBetween and
+// MaxBetween are counted under. the time is taken once the lock is held,
+// so it measures the work, not waiting for the lock. off by default, when
+// nothing is timed. a Clone records into the same histograms.
+func WithOpLatencies() Option {
+	return func(o *options) {
+		o.latencies = &latencies{ops: make(map[string]*LatencyStats)}
+	}
+}
+
+// deferred by a timed operation with the time it started
+func (r *latencies) record(op string, start time.Time) {
+	d := time.Since(start)
+	b := len(latencyBounds)
+	for i, le := range latencyBounds {
+		if d <= le {
+			b = i
+			break
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	s, ok := r.ops[op]
+	if !ok {
+		s = &LatencyStats{}
+		r.ops[op] = s
+	}
+	s.Count++
+	s.Total += d
+	s.Max = max(s.Max, d)
+	s.Buckets[b]++
+}
+
+// copy of the durations recorded with WithOpLatencies by operation, named
+// by method such as "Add" or "Range", nil without WithOpLatencies
+func (l *History[T]) OpLatencies() map[string]LatencyStats {
+	if l.latencies == nil {
+		return nil
+	}
+	l.latencies.mux.Lock()
+	defer l.latencies.mux.Unlock()
+
+	ops := make(map[string]LatencyStats, len(l.latencies.ops))
+	for op, s := range l.latencies.ops {
+		ops[op] = *s
+	}
+	return ops
+}
@@ -0,0 +1,42 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+// operations are counted per method only with WithOpLatencies
+func TestOpLatencies(t *testing.T) {
+	if ops := MakeHistory[int](time.Hour).OpLatencies(); ops != nil {
+		t.Error("expected nothing timed by default, got", ops)
+	}
+
+	lg := MakeHistory[int](time.Hour, WithOpLatencies())
+	tm := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	lg.AddWithTTL(tm.Add(10*time.Second), 10, time.Hour)
+	lg.AddWeighted(tm.Add(11*time.Second), 11, 2)
+	lg.AddTagged(tm.Add(12*time.Second), 12, nil)
+	lg.Before(tm.Add(5 * time.Second))
+	lg.SumBetween(tm, tm.Add(time.Minute), func(a int, b int) int { return a + b })
+
+	ops := lg.OpLatencies()
+	if ops["Add"].Count != 10 || ops["Before"].Count != 1 || ops["Fold"].Count != 1 {
+		t.Error("expected 10 Adds, 1 Before and 1 Fold, got", ops)
+	}
+	for _, op := range []string{"AddWithTTL", "AddWeighted", "AddTagged"} {
+		if ops[op].Count != 1 {
+			t.Error("expected 1", op, "got", ops[op])
+		}
+	}
+	add := ops["Add"]
+	n := 0
+	for _, c := range add.Buckets {
+		n += c
+	}
+	if n != add.Count || add.Max < add.Mean() || add.Total <= 0 {
+		t.Error("expected the buckets to sum to the count, got", add)
+	}
+}
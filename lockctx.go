@@ -0,0 +1,95 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// longest wait between two attempts of acquire
+const maxLockBackoff = time.Millisecond
+
+// rlock giving up with ErrLockTimeout, wrapping ctx's error, once ctx is
+// done. a ctx that is never done takes the lock as rlock does.
+//
+// sync.RWMutex has no acquire with a deadline, so the lock is polled with
+// TryRLock, waiting a little longer after each failed attempt up to
+// maxLockBackoff. that costs up to maxLockBackoff of latency once the lock
+// frees, and under heavy write load a poller can keep losing to the
+// goroutines blocked in Lock and RLock, which are queued and let in ahead of
+// it, so it may time out where a blocking read would have got through.
+func (l *History[T]) rlockCtx(ctx context.Context) error {
+	if ctx.Done() == nil {
+		l.rlock()
+		return nil
+	}
+
+	if l.autoTrim {
+		if err := acquire(ctx, l.mux.TryRLock); err != nil {
+			return err
+		}
+		now := l.clock.Now()
+		stale := l.stale(now) || l.expiring(now)
+		l.mux.RUnlock()
+		if stale {
+			if err := acquire(ctx, l.mux.TryLock); err != nil {
+				return err
+			}
+			l.trim(l.clock.Now())
+			l.unlock()
+		}
+	}
+	return acquire(ctx, l.mux.TryRLock)
+}
+
+// calls try until it succeeds or ctx is done
+func acquire(ctx context.Context, try func() bool) error {
+	wait := 10 * time.Microsecond
+	var timer *time.Timer
+	for !try() {
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrLockTimeout, ctx.Err())
+		case <-timer.C:
+		}
+		wait = min(2*wait, maxLockBackoff)
+	}
+	return nil
+}
+
+// Before giving up with ErrLockTimeout if the read lock can't be had before
+// ctx is done
+func (l *History[T]) BeforeCtx(ctx context.Context, wanted time.Time) (T, time.Time, error) {
+	if err := l.rlockCtx(ctx); err != nil {
+		var zero T
+		return zero, time.Time{}, err
+	}
+	defer l.mux.RUnlock()
+	if l.observer != nil {
+		defer l.observeLookup(time.Now())
+	}
+
+	return l.before(wanted)
+}
+
+// Range giving up with ErrLockTimeout if the read lock can't be had before
+// ctx is done
+func (l *History[T]) RangeCtx(ctx context.Context, from time.Time, to time.Time) ([]Entry[T], error) {
+	if err := l.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer l.mux.RUnlock()
+
+	if len(l.times) == 0 {
+		return nil, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	return l.entriesIn(lo, hi), nil
+}
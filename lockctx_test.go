@@ -0,0 +1,37 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// reads with a deadline give up while a writer holds the lock
+func TestLockTimeout(t *testing.T) {
+	lg := MakeHistory[int](time.Hour, WithAutoTrim())
+	tm := time.Now()
+	lg.Add(tm, 1)
+
+	lg.mux.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lg.RangeCtx(ctx, tm, tm.Add(time.Minute)); !errors.Is(err, ErrLockTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected lock timeout, got", err)
+	}
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	if _, err := lg.AvgBetweenCtx(ctx, tm, tm.Add(time.Minute), sum, div); !errors.Is(err, ErrLockTimeout) {
+		t.Error("expected lock timeout, got", err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		lg.mux.Unlock()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if p, _, err := lg.BeforeCtx(ctx, tm.Add(time.Second)); err != nil || p != 1 {
+		t.Error("expected the lock once freed, got", p, err)
+	}
+}
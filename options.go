@@ -0,0 +1,251 @@
+package history
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// source of the current time, time.Now unless set with WithClock
+type Clock interface {
+	Now() time.Time
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// configures a History at construction
+type Option func(*options)
+
+type options struct {
+	clock         Clock                   // source of the current time
+	itemSize      int                     // approximate bytes per item, 0 for the size of T
+	bounds        Bounds                  // which ends of a from, to window are included
+	autoTrim      bool                    // Trim before each read
+	observer      Observer                // told of adds, evictions and lookups, nil for none
+	rejectEvicted bool                    // refuse Adds that would be evicted straight away
+	logger        *slog.Logger            // warned of data quality problems, nil for none
+	initialCap    int                     // items room is made for up front
+	seq           bool                    // number items in the order they are stored
+	maxEntries    int                     // safety ceiling on the number of items, 0 for none
+	recoverPanics bool                    // return panics in callbacks as errors
+	resolution    time.Duration           // added times are rounded to a multiple of it, 0 for none
+	ingestEvery   time.Duration           // Adds this close to the newest item are dropped, 0 for none
+	timeKey       func(t time.Time) int64 // canonical key matching times, nil to match exact times
+	maxSkew       time.Duration           // how far ahead of the clock an Add may be, 0 for any
+	latencies     *latencies              // durations of the main operations, nil when not timed
+}
+
+func makeOptions(opts []Option) options {
+	o := options{clock: wallClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// use c instead of the wall clock wherever the current time is needed
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// which ends of a from, to window the window methods include
+type Bounds int
+
+const (
+	ClosedOpen Bounds = iota // [from, to), the default
+	Closed                   // [from, to]
+	OpenClosed               // (from, to]
+	Open                     // (from, to)
+)
+
+func (b Bounds) String() string {
+	switch b {
+	case ClosedOpen:
+		return "[)"
+	case Closed:
+		return "[]"
+	case OpenClosed:
+		return "(]"
+	case Open:
+		return "()"
+	}
+	return fmt.Sprintf("Bounds(%d)", int(b))
+}
+
+func (b Bounds) includesFrom() bool {
+	return b == ClosedOpen || b == Closed
+}
+
+func (b Bounds) includesTo() bool {
+	return b == Closed || b == OpenClosed
+}
+
+// sets the bounds used by every method taking a from, to window
+func WithBounds(b Bounds) Option {
+	return func(o *options) {
+		o.bounds = b
+	}
+}
+
+// approximate bytes an item takes, including anything it points to, for
+// ApproxBytes. without it only the size of T itself is counted.
+func WithItemSize(n int) Option {
+	return func(o *options) {
+		o.itemSize = max(n, 0)
+	}
+}
+
+// Trim at the start of every read, so that reads see the window relative to
+// the clock's now even when Adds have stopped. the check is cheap but a read
+// that does trim takes the write lock for it.
+func WithAutoTrim() Option {
+	return func(o *options) {
+		o.autoTrim = true
+	}
+}
+
+// receives internal stats of a History for metrics. its methods are called
+// under the History's lock, so they must be quick and must not call back
+// into the History.
+type Observer interface {
+	ObserveAdd()                   // an item was stored
+	ObserveEvict(n int)            // an eviction pass removed n items, possibly 0
+	ObserveLookup(d time.Duration) // a point lookup such as Before took d
+}
+
+// report internal stats to obs. without an observer nothing is timed or
+// counted.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// make Add, AddNow, AddOrReplace, AddWithTTL, AddWeighted and AddTagged
+// refuse with ErrTooOld an item so old it would be evicted straight away,
+// instead of storing and evicting it. AddBatch and Merge are unaffected.
+func WithRejectEvicted() Option {
+	return func(o *options) {
+		o.rejectEvicted = true
+	}
+}
+
+// log duplicate timestamps, out of order inserts and minKeep holding back
+// eviction by age to logger at warn level. the control flow is unchanged,
+// and without a logger nothing is logged. logging happens under the lock,
+// so the handler must not call back into the History.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// number each item stored from 1 up, reported as the Seq of the entries
+// returned, so that the order items arrived in can be checked and
+// reproduced alongside their time order. Seq is the order items were stored
+// in, not their time order: a late insert gets a higher Seq than the newer
+// items around it, and replacing an item gives it a new Seq. decoding
+// numbers the loaded items afresh in time order.
+func WithSeq() Option {
+	return func(o *options) {
+		o.seq = true
+	}
+}
+
+// safety ceiling of n items, evicting the oldest beyond it whatever length,
+// minKeep and the other limits would keep, so that a burst of Adds into a
+// long length can't run out of memory. it is meant never to be reached, so
+// each time it evicts a warning goes to the WithLogger logger. off by
+// default, and an n of 0 or less leaves it off. RingHistory ignores it.
+func WithMaxEntries(n int) Option {
+	return func(o *options) {
+		o.maxEntries = max(n, 0)
+	}
+}
+
+// recover from a panic in a callback passed to a window method, such as the
+// sum, div or less of AvgBetween, and return it from the method as an
+// ErrPanic error instead, so a callback failing on a malformed item can't
+// bring down a shared service. the lock is released either way. off by
+// default, when the panic propagates to the caller.
+func WithRecover() Option {
+	return func(o *options) {
+		o.recoverPanics = true
+	}
+}
+
+// deferred by the window methods, with WithRecover turns a panic into *err
+func (o *options) catch(err *error) {
+	if !o.recoverPanics {
+		return
+	}
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %v", ErrPanic, r)
+	}
+}
+
+// round the time of every item added, by Add and its variants, AddBatch
+// and Merge, or decoded, to the nearest multiple of d, so that jitter
+// below d is dropped and buckets aligned to d see the items cleanly. items
+// that round to one time collide as duplicates do: Add rejects the later
+// with ErrDuplicate, keeping the first, while AddOrReplace keeps the last,
+// and decoding fails. lookups such as Get and Remove take the stored,
+// rounded, times. a d of 0 or less does no rounding. RingHistory ignores
+// it.
+func WithResolution(d time.Duration) Option {
+	return func(o *options) {
+		o.resolution = max(d, 0)
+	}
+}
+
+// make room for n items up front, and again on Clear, so filling a History
+// known to grow big does not keep regrowing the times slice and the map.
+// RingHistory allocates its capacity anyway and ignores it.
+func WithInitialCapacity(n int) Option {
+	return func(o *options) {
+		o.initialCap = max(n, 0)
+	}
+}
+
+// keep at most one item per d on ingest: Add, AddNow, AddWithTTL,
+// AddWeighted and AddTagged drop an item less than d from the newest item
+// stored, and return the newest entry instead, so an over-sampling source
+// is thinned at write time rather than downsampled later. as it measures
+// from the newest item, a late Add at least d before the newest is stored
+// even if close to an older item, and a late Add within d of it is
+// dropped. AddOrReplace, AddBatch and Merge are
+// unaffected. a d of 0 or less drops nothing. RingHistory ignores it.
+func WithIngestInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.ingestEvery = max(d, 0)
+	}
+}
+
+// match times by key of them rather than as exact times, so that Add finds
+// duplicates and Get, Remove and Labels find items by the canonical key,
+// say UnixNano, whatever location or monotonic reading a time carries.
+// entries keep the time they were first stored with. the key should give
+// equal instants one key, as UnixNano does, since items are ordered by
+// instant. RingHistory ignores it.
+func WithTimeKey(key func(t time.Time) int64) Option {
+	return func(o *options) {
+		o.timeKey = key
+	}
+}
+
+// make Add, AddOrReplace, AddWithTTL, AddWeighted and AddTagged refuse
+// with ErrFuture an item more than d ahead of the clock's now, as eviction
+// by length measures from the newest item and one bad far future time would
+// evict everything else down to minKeep. AddBatch and Merge are unaffected.
+// off by default, and a d of 0 or less leaves it off.
+func WithMaxFutureSkew(d time.Duration) Option {
+	return func(o *options) {
+		o.maxSkew = max(d, 0)
+	}
+}
@@ -0,0 +1,118 @@
+package history
+
+import (
+	"time"
+)
+
+// retention rule for MakeHistoryWithPolicy. after every Add, and every
+// other write that evicts, Evict is given the stored times oldest first and
+// returns how many of the oldest to evict. it is called under the write
+// lock, so it must not call back into the History, and it must return the
+// same for the same times, as nothing else is passed to it.
+type EvictionPolicy interface {
+	Evict(times []time.Time) int
+}
+
+// evicts items more than Length older than the newest, keeping at least
+// MinKeep. the rule MakeHistoryWithMin builds in.
+type DurationPolicy struct {
+	Length  time.Duration
+	MinKeep int
+}
+
+func (p DurationPolicy) Evict(times []time.Time) int {
+	if p.Length <= 0 || len(times) == 0 {
+		return 0
+	}
+	newest := times[len(times)-1]
+	n := indexAtOrAfter(times, newest.Add(-p.Length))
+	return max(min(n, len(times)-p.MinKeep), 0)
+}
+
+// keeps the newest Max items, the rule of MakeHistoryWithCapacity
+type CountPolicy struct {
+	Max int
+}
+
+func (p CountPolicy) Evict(times []time.Time) int {
+	if p.Max <= 0 {
+		return 0
+	}
+	return max(len(times)-p.Max, 0)
+}
+
+// keeps the estimated footprint under MaxBytes, at ItemSize bytes per item
+// counted as ApproxBytes counts them, keeping at least MinKeep. the rule of
+// MakeHistoryWithByteBudget, and as approximate.
+type ByteBudgetPolicy struct {
+	MaxBytes int
+	ItemSize int
+	MinKeep  int
+}
+
+func (p ByteBudgetPolicy) Evict(times []time.Time) int {
+	if p.MaxBytes <= 0 {
+		return 0
+	}
+	per := timeSize + slotSize(max(p.ItemSize, 0))
+	return max(min(len(times)-p.MaxBytes/per, len(times)-p.MinKeep), 0)
+}
+
+// evicts what the strictest of its policies evicts, so an item stays only
+// while every policy keeps it
+type CompositePolicy []EvictionPolicy
+
+func (p CompositePolicy) Evict(times []time.Time) int {
+	n := 0
+	for _, policy := range p {
+		n = max(n, policy.Evict(times))
+	}
+	return n
+}
+
+// the built in rules over a History's current length, minKeep, capacity,
+// byte budget and WithMaxEntries, with its MakeHistoryWithPolicy policy if
+// any: the composite every eviction pass evicts by. a value rather than a
+// CompositePolicy so that building one on every Add does not allocate.
+type retention struct {
+	duration DurationPolicy
+	bytes    ByteBudgetPolicy
+	capacity CountPolicy
+	ceiling  CountPolicy
+	policy   EvictionPolicy
+}
+
+func (p retention) Evict(times []time.Time) int {
+	n := max(p.duration.Evict(times), p.bytes.Evict(times), p.capacity.Evict(times), p.ceiling.Evict(times))
+	if p.policy != nil {
+		n = max(n, p.policy.Evict(times))
+	}
+	return n
+}
+
+// caller holds the lock. the retention the History evicts by now
+func (l *History[T]) retention() retention {
+	return retention{
+		duration: DurationPolicy{Length: l.length, MinKeep: l.minKeep},
+		bytes:    ByteBudgetPolicy{MaxBytes: l.byteBudget, ItemSize: l.itemBytes(), MinKeep: l.minKeep},
+		capacity: CountPolicy{Max: l.capacity},
+		ceiling:  CountPolicy{Max: l.maxEntries},
+		policy:   l.policy,
+	}
+}
+
+// history retaining by policy on top of the built in rules, which start
+// out off: no length, minKeep or capacity. the other constructors are this
+// with a nil policy and the rule they name set, so MakeHistory(d) retains
+// as MakeHistoryWithPolicy(DurationPolicy{Length: d, MinKeep:
+// defaultMinKeep}) does, and UpdateMinKeep and AutoDuration adjust the
+// built in rules of either kind of History.
+func MakeHistoryWithPolicy[T any](policy EvictionPolicy, opts ...Option) *History[T] {
+	o := makeOptions(opts)
+	return &History[T]{
+		options: o,
+		policy:  policy,
+		t:       make(map[time.Time]T, o.initialCap),
+		times:   make([]time.Time, 0, o.initialCap),
+	}
+}
@@ -0,0 +1,58 @@
+package history
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// the built in policies retain what the matching constructors do
+func TestPolicyMatchesBuiltIn(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pairs := []struct {
+		name    string
+		builtIn *History[int]
+		policy  *History[int]
+	}{
+		{"duration", MakeHistory[int](time.Minute), MakeHistoryWithPolicy[int](DurationPolicy{Length: time.Minute, MinKeep: defaultMinKeep})},
+		{"count", MakeHistoryWithCapacity[int](50), MakeHistoryWithPolicy[int](CountPolicy{Max: 50})},
+		{"bytes", MakeHistoryWithByteBudget[int](10_000, 100), MakeHistoryWithPolicy[int](ByteBudgetPolicy{MaxBytes: 10_000, ItemSize: 100})},
+	}
+
+	tm := time.Unix(0, 0)
+	for i := 0; i < 1000; i++ {
+		tm = tm.Add(time.Duration(rng.Intn(1000)) * time.Millisecond)
+		for _, p := range pairs {
+			p.builtIn.Add(tm, i)
+			p.policy.Add(tm, i)
+		}
+	}
+	for _, p := range pairs {
+		if !slices.Equal(p.builtIn.Snapshot(), p.policy.Snapshot()) {
+			t.Error(p.name, "policy kept", p.policy.Len(), "items, built in", p.builtIn.Len())
+		}
+	}
+}
+
+// a composite keeps an item only while all its policies do
+func TestCompositePolicy(t *testing.T) {
+	var evicted []int
+	lg := MakeHistoryWithPolicy[int](CompositePolicy{
+		DurationPolicy{Length: 10 * time.Second},
+		CountPolicy{Max: 5},
+	})
+	lg.OnEvict(func(t time.Time, it int) { evicted = append(evicted, it) })
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 8; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if lg.Len() != 5 || !slices.Equal(evicted, []int{0, 1, 2}) {
+		t.Error("expected the count to evict, got", lg.Len(), evicted)
+	}
+	lg.Add(tm.Add(20*time.Second), 20)
+	if lg.Len() != 1 {
+		t.Error("expected the duration to evict, got", lg.Len())
+	}
+}
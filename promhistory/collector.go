@@ -0,0 +1,117 @@
+// exposes stats derived from a History as Prometheus gauges. kept apart
+// from the history package so only users of this adapter depend on
+// prometheus.
+package promhistory
+
+import (
+	"time"
+
+	"github.com/prateshg/history"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// a gauge computed on scrape from the entries newer than now - Window,
+// oldest first, or all entries if Window is 0 or less
+type Aggregation[T any] struct {
+	Name   string // appended to the collector's name
+	Help   string
+	Window time.Duration
+	Fn     func(entries []history.Entry[T]) float64
+}
+
+// mean of value over the entries in window, no sample for an empty window
+func Avg[T any](window time.Duration, value func(it T) float64) Aggregation[T] {
+	return Aggregation[T]{
+		Name:   "avg",
+		Help:   "Average of the items in the trailing window.",
+		Window: window,
+		Fn: func(entries []history.Entry[T]) float64 {
+			sum := 0.0
+			for _, e := range entries {
+				sum += value(e.Item)
+			}
+			return sum / float64(len(entries))
+		},
+	}
+}
+
+// prometheus.Collector reporting a History's item count, the age of its
+// oldest item and any further aggregations. a scrape copies the entries
+// under the History's read lock and computes everything after releasing
+// it, so Adds are only blocked for the copy.
+type Collector[T any] struct {
+	h     *history.History[T]
+	clock history.Clock
+	aggs  []Aggregation[T]
+
+	count     *prometheus.Desc
+	oldestAge *prometheus.Desc
+	aggDescs  []*prometheus.Desc
+}
+
+// collector for h whose metrics are named name_count, name_oldest_age_seconds
+// and name_ followed by each aggregation's Name. ages and windows are
+// measured from clock, the wall clock if nil.
+func NewCollector[T any](h *history.History[T], name string, clock history.Clock, aggs ...Aggregation[T]) *Collector[T] {
+	if clock == nil {
+		clock = wallClock{}
+	}
+	c := &Collector[T]{
+		h:         h,
+		clock:     clock,
+		aggs:      aggs,
+		count:     prometheus.NewDesc(name+"_count", "Number of items in the history.", nil, nil),
+		oldestAge: prometheus.NewDesc(name+"_oldest_age_seconds", "Age of the oldest item in the history.", nil, nil),
+	}
+	for _, a := range aggs {
+		c.aggDescs = append(c.aggDescs, prometheus.NewDesc(name+"_"+a.Name, a.Help, nil, nil))
+	}
+	return c
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *Collector[T]) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.count
+	ch <- c.oldestAge
+	for _, d := range c.aggDescs {
+		ch <- d
+	}
+}
+
+// gauges with no items to report on are left out of the scrape
+func (c *Collector[T]) Collect(ch chan<- prometheus.Metric) {
+	entries := c.h.Snapshot()
+	now := c.clock.Now()
+
+	ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(len(entries)))
+	if len(entries) == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.oldestAge, prometheus.GaugeValue, now.Sub(entries[0].Time).Seconds())
+
+	for i, a := range c.aggs {
+		window := entries
+		if a.Window > 0 {
+			window = since(entries, now.Add(-a.Window))
+		}
+		if len(window) == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.aggDescs[i], prometheus.GaugeValue, a.Fn(window))
+	}
+}
+
+// the entries after cutoff
+func since[T any](entries []history.Entry[T], cutoff time.Time) []history.Entry[T] {
+	for i, e := range entries {
+		if e.Time.After(cutoff) {
+			return entries[i:]
+		}
+	}
+	return nil
+}
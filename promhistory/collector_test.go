@@ -0,0 +1,61 @@
+package promhistory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prateshg/history"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestCollector(t *testing.T) {
+	tm := time.Unix(1000, 0)
+	h := history.MakeHistory[float64](time.Hour)
+	for i := 0; i < 10; i++ {
+		h.Add(tm.Add(time.Duration(i)*time.Second), float64(i))
+	}
+
+	clock := fixedClock{tm.Add(time.Duration(10) * time.Second)}
+	value := func(it float64) float64 { return it }
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewCollector(h, "test", clock, Avg(time.Duration(4)*time.Second, value)))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range families {
+		got[mf.GetName()] = mf.GetMetric()[0].GetGauge().GetValue()
+	}
+	// the last 4 seconds hold 7, 8 and 9
+	want := map[string]float64{"test_count": 10, "test_oldest_age_seconds": 10, "test_avg": 8}
+	for name, v := range want {
+		if got[name] != v {
+			t.Error(name, "expected", v, "got", got[name])
+		}
+	}
+}
+
+// an empty History reports only its count
+func TestCollectorEmpty(t *testing.T) {
+	h := history.MakeHistory[float64](time.Hour)
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewCollector(h, "test", nil, Avg(time.Minute, func(it float64) float64 { return it })))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "test_count" {
+		t.Error("expected only the count, got", families)
+	}
+}
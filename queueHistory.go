@@ -1,7 +1,6 @@
 package history
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -37,7 +36,7 @@ func (l *QueueHistory) Latest() (HistoryItem, error) {
 	if len(l.m) > 0 {
 		return l.m[len(l.m)-1], nil
 	}
-	return nil, fmt.Errorf("empty log")
+	return nil, ErrEmpty
 }
 
 func (l *QueueHistory) Oldest() (HistoryItem, error) {
@@ -46,5 +45,5 @@ func (l *QueueHistory) Oldest() (HistoryItem, error) {
 	if len(l.m) > 0 {
 		return l.m[0], nil
 	}
-	return nil, fmt.Errorf("empty log")
+	return nil, ErrEmpty
 }
@@ -0,0 +1,39 @@
+package history
+
+import (
+	"context"
+	"time"
+)
+
+// calls emit on the entries in the from, to window, oldest first, waiting
+// between two entries for the time between them divided by speed: 1 replays
+// in real time, 2 at double speed, and 0 or less without waiting. the waits
+// are on the wall clock whatever Clock is set. the window is copied first,
+// so the lock is not held while waiting and emit may call back into the
+// History. stops with ctx's error once ctx is done.
+func (l *History[T]) Replay(ctx context.Context, from time.Time, to time.Time, speed float64, emit func(e Entry[T])) error {
+	entries, _ := l.Range(from, to)
+
+	var timer *time.Timer
+	for i, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i > 0 && speed > 0 {
+			wait := time.Duration(float64(e.Time.Sub(entries[i-1].Time)) / speed)
+			if timer == nil {
+				timer = time.NewTimer(wait)
+				defer timer.Stop()
+			} else {
+				timer.Reset(wait)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		emit(e)
+	}
+	return nil
+}
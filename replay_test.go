@@ -0,0 +1,55 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// entries come out in order, spaced by their gaps over speed
+func TestReplay(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 3; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+
+	var got []int
+	start := time.Now()
+	err := lg.Replay(context.Background(), tm, tm.Add(time.Minute), 20, func(e Entry[int]) {
+		got = append(got, e.Item)
+	})
+	if err != nil || len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Fatal("Replay got", got, err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Error("expected 2s at 20x to take 100ms, took", elapsed)
+	}
+
+	got = got[:0]
+	lg.Replay(context.Background(), tm, tm.Add(time.Minute), 0, func(e Entry[int]) {
+		got = append(got, e.Item)
+	})
+	if len(got) != 3 {
+		t.Error("Replay at speed 0 got", got)
+	}
+}
+
+// a cancelled replay stops during the wait
+func TestReplayCancel(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+	lg.Add(tm.Add(time.Hour), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	err := lg.Replay(ctx, tm, tm.Add(2*time.Hour), 1, func(e Entry[int]) {
+		n++
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) || n != 1 {
+		t.Error("expected cancel after the first entry, got", n, err)
+	}
+}
@@ -0,0 +1,276 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// History-like store of the newest capacity items in a fixed ring of
+// entries allocated up front. adding the newest item and evicting the
+// oldest are O(1) and allocate nothing, where History churns a map entry
+// per item. a late arrival is inserted in order at O(n) cost.
+//
+// times count as duplicates when Equal, methods taking a from, to window
+// select items by the bounds set with WithBounds, [from, to) by default.
+type RingHistory[T any] struct {
+	options
+	buf  []Entry[T] // entries oldest first starting at head, wrapping around
+	head int        // index in buf of the oldest entry
+	n    int        // number of entries stored
+	mux  sync.RWMutex
+}
+
+// ring history keeping the newest capacity items, at least 1
+func MakeRingHistory[T any](capacity int, opts ...Option) *RingHistory[T] {
+	return &RingHistory[T]{
+		options: makeOptions(opts),
+		buf:     make([]Entry[T], max(capacity, 1)),
+	}
+}
+
+func (l *RingHistory[T]) Len() int {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	return l.n
+}
+
+// number of items kept before the oldest is evicted
+func (l *RingHistory[T]) Capacity() int {
+	return len(l.buf)
+}
+
+// stores it at time t, returning the stored entry. an item already stored
+// at t is kept and ErrDuplicate returned. when the ring is full the oldest
+// item is evicted, which is the new one if it is older than all others.
+func (l *RingHistory[T]) Add(t time.Time, it T) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.add(t, it)
+}
+
+// stores it at the clock's current time, read under the lock
+func (l *RingHistory[T]) AddNow(it T) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.add(l.clock.Now(), it)
+}
+
+// caller holds the lock
+func (l *RingHistory[T]) add(t time.Time, it T) (Entry[T], error) {
+	e := Entry[T]{Time: t, Item: it}
+	i := l.indexAfter(t)
+	if i > 0 && l.at(i-1).Time.Equal(t) {
+		return Entry[T]{}, fmt.Errorf("%w: %v", ErrDuplicate, t)
+	}
+
+	if l.n == len(l.buf) {
+		if i == 0 {
+			return e, nil
+		}
+		l.evictOldest()
+		i--
+	}
+
+	// shift the newer entries up to make room at i
+	for j := l.n; j > i; j-- {
+		*l.ptr(j) = l.at(j - 1)
+	}
+	*l.ptr(i) = e
+	l.n++
+	return e, nil
+}
+
+// caller holds the lock
+func (l *RingHistory[T]) evictOldest() {
+	l.buf[l.head] = Entry[T]{}
+	l.head = (l.head + 1) % len(l.buf)
+	l.n--
+}
+
+// caller holds the lock. entry i counting from the oldest
+func (l *RingHistory[T]) at(i int) Entry[T] {
+	return *l.ptr(i)
+}
+
+func (l *RingHistory[T]) ptr(i int) *Entry[T] {
+	return &l.buf[(l.head+i)%len(l.buf)]
+}
+
+// caller holds the lock. index of the first entry strictly after t, n if none
+func (l *RingHistory[T]) indexAfter(t time.Time) int {
+	return sort.Search(l.n, func(i int) bool { return l.at(i).Time.After(t) })
+}
+
+// caller holds the lock. index of the first entry at or after t, n if none
+func (l *RingHistory[T]) indexAtOrAfter(t time.Time) int {
+	return sort.Search(l.n, func(i int) bool { return !l.at(i).Time.Before(t) })
+}
+
+// caller holds the lock. index range [lo, hi) of the entries in the
+// from, to window under the configured bounds, lo == hi if it is empty.
+func (l *RingHistory[T]) window(from time.Time, to time.Time) (int, int) {
+	lo := l.indexAfter(from)
+	if l.bounds.includesFrom() {
+		lo = l.indexAtOrAfter(from)
+	}
+	hi := l.indexAtOrAfter(to)
+	if l.bounds.includesTo() {
+		hi = l.indexAfter(to)
+	}
+	return lo, max(hi, lo)
+}
+
+// last item at or before given time and time it was logged, with the same
+// errors as History.Before
+func (l *RingHistory[T]) Before(wanted time.Time) (T, time.Time, error) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		var zero T
+		return zero, l.clock.Now(), ErrEmpty
+	}
+
+	i := l.indexAfter(wanted)
+	if i == 0 {
+		oldest := l.at(0)
+		return oldest.Item, oldest.Time, ErrBeforeStart
+	}
+	e := l.at(i - 1)
+	return e.Item, e.Time, nil
+}
+
+// first item after given time and time it was logged, with the same
+// errors as History.After
+func (l *RingHistory[T]) After(wanted time.Time) (T, time.Time, error) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		var zero T
+		return zero, l.clock.Now(), ErrEmpty
+	}
+
+	i := l.indexAfter(wanted)
+	if i == l.n {
+		newest := l.at(l.n - 1)
+		return newest.Item, newest.Time, ErrAfterEnd
+	}
+	e := l.at(i)
+	return e.Item, e.Time, nil
+}
+
+// oldest item and its time, false if the ring is empty
+func (l *RingHistory[T]) Oldest() (T, time.Time, bool) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	e := l.at(0)
+	return e.Item, e.Time, true
+}
+
+// newest item and its time, false if the ring is empty
+func (l *RingHistory[T]) Newest() (T, time.Time, bool) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	e := l.at(l.n - 1)
+	return e.Item, e.Time, true
+}
+
+// number of items in the start, end window
+func (l *RingHistory[T]) NumItemsBetween(start time.Time, end time.Time) (int, error) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		return 0, ErrEmpty
+	}
+
+	lo, hi := l.window(start, end)
+	return hi - lo, nil
+}
+
+// entries in the from, to window, oldest first.
+// the returned slice is a copy owned by the caller.
+func (l *RingHistory[T]) Range(from time.Time, to time.Time) ([]Entry[T], error) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	if l.n == 0 {
+		return nil, ErrEmpty
+	}
+
+	lo, hi := l.window(from, to)
+	return l.entriesIn(lo, hi), nil
+}
+
+// calls fn on the items in the from, to window, oldest first, until fn
+// returns false. the lock is held throughout, so fn must not call back
+// into the RingHistory.
+func (l *RingHistory[T]) ForEach(from time.Time, to time.Time, fn func(t time.Time, it T) bool) {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	for i := lo; i < hi; i++ {
+		if e := l.at(i); !fn(e.Time, e.Item) {
+			return
+		}
+	}
+}
+
+// all entries oldest first, taken atomically
+func (l *RingHistory[T]) Snapshot() []Entry[T] {
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	return l.entriesIn(0, l.n)
+}
+
+// caller holds the lock. copy of the entries at indexes [lo, hi)
+func (l *RingHistory[T]) entriesIn(lo int, hi int) []Entry[T] {
+	entries := make([]Entry[T], hi-lo)
+	for i := range entries {
+		entries[i] = l.at(lo + i)
+	}
+	return entries
+}
+
+// average of items in the from, to window, summed starting from the zero
+// value of T
+func (l *RingHistory[T]) AvgBetween(
+	from time.Time,
+	to time.Time,
+	sum func(a T, b T) T,
+	div func(a T, n int) T,
+) (_ T, err error) {
+	defer l.catch(&err)
+	l.mux.RLock()
+	defer l.mux.RUnlock()
+
+	lo, hi := l.window(from, to)
+	if lo == hi {
+		var zero T
+		return zero, ErrNoValues
+	}
+
+	var cum T
+	for i := lo; i < hi; i++ {
+		cum = sum(cum, l.at(i).Item)
+	}
+	return div(cum, hi-lo), nil
+}
@@ -0,0 +1,112 @@
+package history
+
+import (
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// a RingHistory holds the same entries as a History with the same capacity
+func TestRingMatchesHistory(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ring := MakeRingHistory[int](50)
+	lg := MakeHistoryWithCapacity[int](50)
+	tm := time.Unix(0, 0)
+
+	for i := 0; i < 2000; i++ {
+		// mostly in order with some late arrivals and duplicates
+		at := tm.Add(time.Duration(i-r.Intn(80)) * time.Second)
+		_, errR := ring.Add(at, i)
+		_, errH := lg.Add(at, i)
+		if errors.Is(errR, ErrDuplicate) != errors.Is(errH, ErrDuplicate) {
+			t.Fatal("duplicate mismatch at", i, errR, errH)
+		}
+	}
+
+	if !slices.Equal(ring.Snapshot(), lg.Snapshot()) {
+		t.Fatal("ring and history differ")
+	}
+
+	from, to := tm.Add(time.Duration(1960)*time.Second), tm.Add(time.Duration(1990)*time.Second)
+	gotR, _ := ring.Range(from, to)
+	gotH, _ := lg.Range(from, to)
+	if !slices.Equal(gotR, gotH) {
+		t.Error("Range differs", gotR, gotH)
+	}
+
+	for _, at := range []time.Time{tm, from, to, tm.Add(time.Hour)} {
+		itR, thenR, errR := ring.Before(at)
+		itH, thenH, errH := lg.Before(at)
+		if itR != itH || !thenR.Equal(thenH) || !errors.Is(errR, errH) {
+			t.Error("Before", at, "differs", itR, itH, errR, errH)
+		}
+		itR, thenR, errR = ring.After(at)
+		itH, thenH, errH = lg.After(at)
+		if itR != itH || !thenR.Equal(thenH) || !errors.Is(errR, errH) {
+			t.Error("After", at, "differs", itR, itH, errR, errH)
+		}
+	}
+}
+
+func TestRingEvicts(t *testing.T) {
+	ring := MakeRingHistory[int](3)
+	tm := time.Unix(0, 0)
+	for i := 1; i <= 5; i++ {
+		ring.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if ring.Len() != 3 {
+		t.Error("expected 3 items, got", ring.Len())
+	}
+	if it, _, _ := ring.Oldest(); it != 3 {
+		t.Error("expected oldest 3, got", it)
+	}
+	if it, _, _ := ring.Newest(); it != 5 {
+		t.Error("expected newest 5, got", it)
+	}
+
+	// older than everything kept, so evicted straight away
+	ring.Add(tm, 0)
+	if it, _, _ := ring.Oldest(); it != 3 || ring.Len() != 3 {
+		t.Error("stale add changed the ring, oldest", it)
+	}
+
+	sum := func(a int, b int) int { return a + b }
+	div := func(a int, n int) int { return a / n }
+	if avg, err := ring.AvgBetween(tm, tm.Add(time.Minute), sum, div); err != nil || avg != 4 {
+		t.Error("expected avg 4, got", avg, err)
+	}
+}
+
+func BenchmarkHistoryAdd(b *testing.B) {
+	lg := MakeHistoryWithCapacity[int](1000)
+	tm := time.Unix(0, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lg.Add(tm.Add(time.Duration(i)), i)
+	}
+}
+
+func BenchmarkRingHistoryAdd(b *testing.B) {
+	ring := MakeRingHistory[int](1000)
+	tm := time.Unix(0, 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ring.Add(tm.Add(time.Duration(i)), i)
+	}
+}
+
+// WithRecover returns a panicking callback as an error and frees the lock
+func TestRingRecover(t *testing.T) {
+	lg := MakeRingHistory[int](10, WithRecover())
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 1)
+	sum := func(a int, b int) int { panic("bad item") }
+	if _, err := lg.AvgBetween(tm, tm.Add(time.Minute), sum, nil); !errors.Is(err, ErrPanic) {
+		t.Error("expected panic error, got", err)
+	}
+	if _, err := lg.Add(tm.Add(time.Second), 2); err != nil {
+		t.Error("expected the lock released, got", err)
+	}
+}
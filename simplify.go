@@ -0,0 +1,65 @@
+package history
+
+import (
+	"math"
+)
+
+// lossy compaction of a numeric series: drops entries so that each dropped
+// value is within tolerance of the straight line between the kept entries
+// around it, after Ramer-Douglas-Peucker with distance measured along the
+// value axis. the oldest and newest entries are always kept. this is
+// destructive, Range and the aggregates only see the kept entries from then
+// on, and dropped entries do not go to OnEvict. returns how many were
+// dropped.
+func (l *History[T]) Simplify(tolerance float64, valueOf func(it T) float64) int {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	n := len(l.times)
+	if n < 3 {
+		return 0
+	}
+
+	values := make([]float64, n)
+	for i, t := range l.times {
+		values[i] = valueOf(l.t[t])
+	}
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+
+	type segment struct{ lo, hi int }
+	stack := []segment{{0, n - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		span := float64(l.times[s.hi].Sub(l.times[s.lo]))
+		worst, at := 0.0, -1
+		for i := s.lo + 1; i < s.hi; i++ {
+			frac := 0.0
+			if span > 0 {
+				frac = float64(l.times[i].Sub(l.times[s.lo])) / span
+			}
+			line := values[s.lo] + (values[s.hi]-values[s.lo])*frac
+			if d := math.Abs(values[i] - line); d > worst {
+				worst, at = d, i
+			}
+		}
+		if at >= 0 && worst > tolerance {
+			keep[at] = true
+			stack = append(stack, segment{s.lo, at}, segment{at, s.hi})
+		}
+	}
+
+	kept := l.times[:0]
+	for i, t := range l.times {
+		if keep[i] {
+			kept = append(kept, t)
+		} else {
+			l.del(t)
+		}
+	}
+	clear(l.times[len(kept):])
+	l.times = kept
+	return n - len(kept)
+}
@@ -0,0 +1,40 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// a line with one spike keeps the ends and the spike
+func TestSimplify(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	for i := 0; i <= 20; i++ {
+		v := float64(i) + 0.01*float64(i%2)
+		if i == 10 {
+			v = 50
+		}
+		lg.Add(tm.Add(time.Duration(i)*time.Second), v)
+	}
+	value := func(it float64) float64 { return it }
+
+	removed := lg.Simplify(0.1, value)
+	if removed != 16 || lg.Len() != 5 {
+		t.Error("expected 5 entries kept, got", lg.Snapshot())
+	}
+	lerp := func(a float64, b float64, frac float64) float64 { return a + (b-a)*frac }
+	for i := 0; i <= 20; i++ {
+		want := float64(i) + 0.01*float64(i%2)
+		if i == 10 {
+			want = 50
+		}
+		got, _ := lg.Interpolate(tm.Add(time.Duration(i)*time.Second), lerp)
+		if math.Abs(got-want) > 0.1 {
+			t.Error("at", i, "expected within tolerance of", want, "got", got)
+		}
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"math"
+	"slices"
+)
+
+// relative error used by TrackQuantiles for an out of range relErr
+const defaultRelErr = 0.01
+
+// quantile sketch with relative error alpha, after DDSketch. values are
+// counted in logarithmic buckets [gamma^(i-1), gamma^i) with
+// gamma = (1+alpha)/(1-alpha), so any value reported for a quantile is
+// within a factor of alpha of the true one. adding and removing a value are
+// O(1), and the number of buckets grows only with the log of the value range.
+type quantileSketch struct {
+	gamma    float64
+	logGamma float64
+	pos      map[int]int // bucket index to count for positive values
+	neg      map[int]int // same for the magnitude of negative values
+	zero     int         // count of zeroes
+	n        int         // count of all values
+}
+
+func makeQuantileSketch(alpha float64) *quantileSketch {
+	gamma := (1 + alpha) / (1 - alpha)
+	return &quantileSketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		pos:      make(map[int]int),
+		neg:      make(map[int]int),
+	}
+}
+
+func (s *quantileSketch) clone() *quantileSketch {
+	c := *s
+	c.pos = make(map[int]int, len(s.pos))
+	c.neg = make(map[int]int, len(s.neg))
+	for i, n := range s.pos {
+		c.pos[i] = n
+	}
+	for i, n := range s.neg {
+		c.neg[i] = n
+	}
+	return &c
+}
+
+func (s *quantileSketch) reset() {
+	clear(s.pos)
+	clear(s.neg)
+	s.zero, s.n = 0, 0
+}
+
+func (s *quantileSketch) add(v float64) {
+	s.count(v, 1)
+}
+
+// v must have been added before
+func (s *quantileSketch) remove(v float64) {
+	s.count(v, -1)
+}
+
+// NaN and infinities have no bucket and are left out
+func (s *quantileSketch) count(v float64, d int) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	s.n += d
+	switch {
+	case v > 0:
+		bump(s.pos, s.index(v), d)
+	case v < 0:
+		bump(s.neg, s.index(-v), d)
+	default:
+		s.zero += d
+	}
+}
+
+func bump(buckets map[int]int, i int, d int) {
+	if buckets[i] += d; buckets[i] == 0 {
+		delete(buckets, i)
+	}
+}
+
+// bucket of the positive value v
+func (s *quantileSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// midpoint of bucket i, within alpha of every value in it
+func (s *quantileSketch) value(i int) float64 {
+	return 2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1)
+}
+
+// estimate of the value at the nearest rank for p, 0 <= p <= 1, for n > 0
+func (s *quantileSketch) quantile(p float64) float64 {
+	rank := nearestRank(p, s.n)
+
+	// negative values run from the largest magnitude up towards zero
+	negs := sortedKeys(s.neg)
+	slices.Reverse(negs)
+	for _, i := range negs {
+		if rank -= s.neg[i]; rank < 0 {
+			return -s.value(i)
+		}
+	}
+	if rank -= s.zero; rank < 0 {
+		return 0
+	}
+	poss := sortedKeys(s.pos)
+	for _, i := range poss {
+		if rank -= s.pos[i]; rank < 0 {
+			return s.value(i)
+		}
+	}
+	if len(poss) == 0 {
+		return 0
+	}
+	return s.value(poss[len(poss)-1])
+}
+
+func sortedKeys(m map[int]int) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
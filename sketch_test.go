@@ -0,0 +1,58 @@
+package history
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// approximate percentiles stay within the relative error of the exact ones,
+// also once items have been evicted
+func TestApproxPercentile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lg := MakeHistoryWithCapacity[float64](5000)
+	lg.TrackQuantiles(func(it float64) float64 { return it }, 0.01)
+	tm := time.Unix(0, 0)
+	for i := 0; i < 20000; i++ {
+		v := math.Exp(r.NormFloat64() * 3)
+		switch r.Intn(10) {
+		case 0:
+			v = -v
+		case 1:
+			v = 0
+		}
+		lg.Add(tm.Add(time.Duration(i)*time.Millisecond), v)
+	}
+
+	less := func(a float64, b float64) bool { return a < b }
+	for _, p := range []float64{0, 0.05, 0.1, 0.25, 0.5, 0.9, 0.99, 1} {
+		exact, _ := lg.PercentileBetween(tm, tm.Add(time.Hour), p, less)
+		approx, err := lg.ApproxPercentile(p)
+		if err != nil || math.Abs(approx-exact) > 0.01*math.Abs(exact)+1e-12 {
+			t.Error("p", p, "expected about", exact, "got", approx, err)
+		}
+	}
+}
+
+func TestApproxPercentileErrors(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	if _, err := lg.ApproxPercentile(0.5); !errors.Is(err, ErrNotTracked) {
+		t.Error("expected not tracked error, got", err)
+	}
+	lg.TrackQuantiles(func(it float64) float64 { return it }, 0)
+	if _, err := lg.ApproxPercentile(0.5); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values error, got", err)
+	}
+	if _, err := lg.ApproxPercentile(1.5); !errors.Is(err, ErrPercentile) {
+		t.Error("expected percentile error, got", err)
+	}
+
+	lg.Add(time.Unix(0, 0), 100)
+	lg.Remove(time.Unix(0, 0))
+	lg.Add(time.Unix(1, 0), 7)
+	if v, err := lg.ApproxPercentile(1); err != nil || math.Abs(v-7) > 0.07 {
+		t.Error("expected about 7, got", v, err)
+	}
+}
@@ -0,0 +1,75 @@
+package history
+
+import (
+	"sync"
+)
+
+// entries buffered per subscriber before new ones are dropped
+const subscribeBuffer = 64
+
+// channels receiving stored entries. sends happen after the History's lock
+// is released, under mux, which cancelling also takes to close a channel.
+type subscribers[T any] struct {
+	mux   sync.Mutex
+	next  int
+	chans map[int]chan Entry[T]
+}
+
+// channel receiving each entry stored from now on, by any Add, AddBatch or
+// Merge, and a func to cancel the subscription and close the channel.
+// entries are sent once the lock is released so a slow consumer cannot
+// stall Add, and a consumer more than subscribeBuffer entries behind misses
+// the newer ones until it catches up. entries from concurrent Adds may
+// arrive out of time order. items stored by Rollup in place of the ones
+// it rolls up are not sent, nor is anything for evictions.
+func (l *History[T]) Subscribe() (<-chan Entry[T], func()) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if l.subs == nil {
+		l.subs = &subscribers[T]{chans: make(map[int]chan Entry[T])}
+	}
+	l.nsubs++
+
+	ch := make(chan Entry[T], subscribeBuffer)
+	l.subs.mux.Lock()
+	// ids wrap round after a lifetime of subscriptions, so skip any still
+	// held by a long lived subscriber rather than overwrite its channel
+	id := l.subs.next
+	for _, ok := l.subs.chans[id]; ok; _, ok = l.subs.chans[id] {
+		id++
+	}
+	l.subs.next = id + 1
+	l.subs.chans[id] = ch
+	l.subs.mux.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			l.mux.Lock()
+			l.nsubs--
+			l.mux.Unlock()
+
+			l.subs.mux.Lock()
+			delete(l.subs.chans, id)
+			close(ch)
+			l.subs.mux.Unlock()
+		})
+	}
+	return ch, cancel
+}
+
+// sends without blocking, dropping entries for full channels
+func (s *subscribers[T]) send(entries []Entry[T]) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, e := range entries {
+		for _, ch := range s.chans {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
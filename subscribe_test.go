@@ -0,0 +1,76 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	tm := time.Unix(0, 0)
+	lg.Add(tm, 0)
+
+	a, cancelA := lg.Subscribe()
+	b, cancelB := lg.Subscribe()
+	defer cancelB()
+	lg.Add(tm.Add(time.Second), 1)
+	lg.AddBatch([]Entry[int]{{Time: tm.Add(time.Duration(2) * time.Second), Item: 2}})
+
+	for _, ch := range []<-chan Entry[int]{a, b} {
+		for want := 1; want <= 2; want++ {
+			if e := <-ch; e.Item != want {
+				t.Error("expected", want, "got", e)
+			}
+		}
+	}
+
+	cancelA()
+	cancelA()
+	if _, ok := <-a; ok {
+		t.Error("expected the cancelled channel closed")
+	}
+	lg.Add(tm.Add(time.Duration(3)*time.Second), 3)
+	if e := <-b; e.Item != 3 {
+		t.Error("expected 3 after the other subscriber left, got", e)
+	}
+}
+
+// a subscriber that does not read drops entries rather than blocking Add
+func TestSubscribeSlowConsumer(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	ch, cancel := lg.Subscribe()
+	defer cancel()
+
+	tm := time.Unix(0, 0)
+	for i := 0; i < 2*subscribeBuffer; i++ {
+		lg.Add(tm.Add(time.Duration(i)*time.Second), i)
+	}
+	if len(ch) != subscribeBuffer {
+		t.Error("expected a full buffer, got", len(ch))
+	}
+	if e := <-ch; e.Item != 0 {
+		t.Error("expected the oldest buffered entry first, got", e)
+	}
+}
+
+// ids wrapped round skip one still in use
+func TestSubscribeIDWrap(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	a, cancelA := lg.Subscribe()
+	defer cancelA()
+	lg.subs.next = 0
+	b, cancelB := lg.Subscribe()
+	defer cancelB()
+
+	lg.Add(time.Unix(0, 0), 1)
+	for _, ch := range []<-chan Entry[int]{a, b} {
+		select {
+		case e := <-ch:
+			if e.Item != 1 {
+				t.Error("expected item 1, got", e)
+			}
+		case <-time.After(time.Second):
+			t.Error("expected both subscribers to receive")
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package history
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// a retention tier for Rollup: items older than After, measured back from
+// the newest item, are rolled up into one item per Every
+type Tier struct {
+	After time.Duration // age past which this tier applies
+	Every time.Duration // width of the buckets rolled up into one item
+}
+
+// keep older items at progressively coarser resolution, as an RRD does,
+// rather than only evicting them. on every Add, each bucket of a tier's
+// Every, aligned to multiples of it, that lies wholly older than the
+// newest item minus the tier's After has its items replaced by the one
+// roll returns for them, stored at the bucket's start with the summed
+// weight of its items, so WeightedAvgBetween counts it as them all. roll
+// gets the items oldest first, and as a coarser tier rolls up items a
+// finer one rolled already, and a late Add into a rolled bucket is rolled
+// with the item already there, roll must compose, as min, max and sums do;
+// carry a count in T for exact averages. TTLs and labels of rolled items
+// are dropped and the rolled item gets a new Seq. range queries see the
+// rolled items as any others, and length, capacity and the other limits
+// still evict them, so length must exceed the tiers for them to matter.
+// ErrInterval for an Every that is not positive. nil roll or no tiers
+// turns rolling up off. Subscribe channels get each item as it is stored
+// and are not sent rolled items.
+func (l *History[T]) Rollup(roll func(items []T) T, tiers ...Tier) error {
+	for _, tr := range tiers {
+		if tr.Every <= 0 {
+			return fmt.Errorf("%w: tier every %v", ErrInterval, tr.Every)
+		}
+	}
+	tiers = slices.Clone(tiers)
+	slices.SortFunc(tiers, func(a Tier, b Tier) int { return cmp.Compare(a.After, b.After) })
+
+	l.mux.Lock()
+	defer l.unlock()
+
+	if roll == nil || len(tiers) == 0 {
+		l.roll, l.tiers, l.rolledTo = nil, nil, nil
+		return nil
+	}
+	l.roll, l.tiers = roll, tiers
+	l.rolledTo = make([]time.Time, len(tiers))
+	l.evict()
+	return nil
+}
+
+// caller holds the lock. rolls up what each tier has newly aged into
+func (l *History[T]) rollUp() {
+	if len(l.times) == 0 {
+		return
+	}
+	newest := l.times[len(l.times)-1]
+	for k, tr := range l.tiers {
+		cutoff := newest.Add(-tr.After)
+		i := indexAtOrAfter(l.times, l.rolledTo[k])
+		if i == len(l.times) || l.times[i].Truncate(tr.Every).Add(tr.Every).After(cutoff) {
+			continue
+		}
+
+		times := slices.Clone(l.times[:i])
+		for i < len(l.times) {
+			start := l.times[i].Truncate(tr.Every)
+			end := start.Add(tr.Every)
+			if end.After(cutoff) {
+				break
+			}
+			j := indexAtOrAfter(l.times, end)
+			if j-i > 1 || !l.times[i].Equal(start) {
+				l.rollBucket(start, l.times[i:j])
+			}
+			times = append(times, start)
+			l.rolledTo[k] = end
+			i = j
+		}
+		l.times = append(times, l.times[i:]...)
+		l.trimmed = 0
+	}
+}
+
+// caller holds the lock. replaces the items at times with one at start
+func (l *History[T]) rollBucket(start time.Time, times []time.Time) {
+	items := make([]T, len(times))
+	weight := 0.0
+	for i, t := range times {
+		items[i] = l.t[t]
+		weight += l.weight(t)
+		l.del(t)
+	}
+	// subscribers saw the originals, the rolled item is not news to them
+	n := len(l.added)
+	l.put(start, l.roll(items))
+	l.added = l.added[:n]
+	if weight != 1 {
+		if l.weights == nil {
+			l.weights = make(map[time.Time]float64)
+		}
+		l.weights[start] = weight
+	}
+}
+
+// caller holds the lock. a late item at t is rolled up again with its bucket
+func (l *History[T]) unroll(t time.Time) {
+	for k, tr := range l.tiers {
+		if t.Before(l.rolledTo[k]) {
+			l.rolledTo[k] = t.Truncate(tr.Every)
+		}
+	}
+}
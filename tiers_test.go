@@ -0,0 +1,77 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// older items are rolled into coarser buckets, keeping the total
+func TestRollup(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	sum := func(items []int) int {
+		s := 0
+		for _, it := range items {
+			s += it
+		}
+		return s
+	}
+	if err := lg.Rollup(sum, Tier{After: time.Minute, Every: 0}); !errors.Is(err, ErrInterval) {
+		t.Error("expected interval error, got", err)
+	}
+	lg.Rollup(sum, Tier{After: time.Minute, Every: 30 * time.Second}, Tier{After: 10 * time.Second, Every: 5 * time.Second})
+
+	tm := time.Unix(0, 0)
+	for i := 0; i <= 100; i++ {
+		lg.Add(seconds(tm, i), 1)
+	}
+	total := func() int {
+		s, _ := lg.SumBetween(tm, seconds(tm, 200), func(a int, b int) int { return a + b })
+		return s
+	}
+	if lg.Len() != 1+12+11 || total() != 101 {
+		t.Error("expected 24 items summing to 101, got", lg.Len(), total())
+	}
+	if it, _ := lg.Get(tm); it != 30 || lg.weight(tm) != 30 {
+		t.Error("expected the first 30s rolled into one, got", it, lg.weight(tm))
+	}
+	if it, _ := lg.Get(seconds(tm, 85)); it != 5 {
+		t.Error("expected 5s buckets past 10s old, got", it)
+	}
+	if _, ok := lg.Get(seconds(tm, 91)); !ok {
+		t.Error("expected the newest 10s at full resolution")
+	}
+
+	// a late item is rolled into its bucket
+	lg.Add(seconds(tm, 12), 1)
+	if it, _ := lg.Get(tm); it != 31 || lg.Len() != 24 || total() != 102 {
+		t.Error("expected the late item rolled into the first bucket, got", it, lg.Len(), total())
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// subscribers see the items added, not the rolled up buckets
+func TestRollupSubscribe(t *testing.T) {
+	lg := MakeHistory[int](time.Hour)
+	lg.Rollup(func(items []int) int { return len(items) }, Tier{After: 10 * time.Second, Every: 5 * time.Second})
+	ch, cancel := lg.Subscribe()
+	defer cancel()
+
+	tm := time.Unix(0, 0)
+	for i := 0; i <= 20; i++ {
+		lg.Add(seconds(tm, i), i)
+		if e := <-ch; e.Item != i || !e.Time.Equal(seconds(tm, i)) {
+			t.Fatal("expected item", i, "got", e)
+		}
+	}
+	if lg.Len() >= 21 {
+		t.Fatal("expected items rolled up, got", lg.Len())
+	}
+	select {
+	case e := <-ch:
+		t.Error("expected no rolled item sent, got", e)
+	default:
+	}
+}
@@ -0,0 +1,71 @@
+package history
+
+import (
+	"container/heap"
+	"slices"
+	"time"
+)
+
+// expiry of the item stored at t
+type deadline struct {
+	at time.Time
+	t  time.Time
+}
+
+// min-heap of deadlines, soonest first. entries whose item has gone or got
+// a new deadline are left in and skipped when they reach the top.
+type deadlineHeap []deadline
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h deadlineHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *deadlineHeap) Push(x any)        { *h = append(*h, x.(deadline)) }
+func (h *deadlineHeap) Pop() any {
+	old := *h
+	d := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return d
+}
+
+// Add for an item that expires once the clock passes t + ttl, even while
+// length would still keep it. whichever of the two is stricter evicts the
+// item first. expired items are dropped on Add and Trim, and on every read
+// with WithAutoTrim, so without it a read can still see an expired item
+// until the next Add. minKeep does not hold back expiry. a ttl of 0 or less
+// stores the item without one. TTLs are not kept by the encoders.
+func (l *History[T]) AddWithTTL(t time.Time, it T, ttl time.Duration) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	e, kept, err := l.insert("AddWithTTL", l.stored(l.stamp(t)), it)
+	if kept && ttl > 0 {
+		if l.deadlines == nil {
+			l.deadlines = make(map[time.Time]time.Time)
+		}
+		l.deadlines[e.Time] = e.Time.Add(ttl)
+		heap.Push(&l.expiries, deadline{at: e.Time.Add(ttl), t: e.Time})
+		l.expire(l.clock.Now())
+	}
+	return e, err
+}
+
+// caller holds the lock. whether an item with a TTL expired before now
+func (l *History[T]) expiring(now time.Time) bool {
+	return len(l.expiries) > 0 && l.expiries[0].at.Before(now)
+}
+
+// caller holds the lock. evicts the items whose TTL expired before now
+func (l *History[T]) expire(now time.Time) {
+	for l.expiring(now) {
+		d := heap.Pop(&l.expiries).(deadline)
+		if at, ok := l.deadlines[d.t]; !ok || !at.Equal(d.at) {
+			continue
+		}
+		i := l.indexOf(d.t)
+		if l.onEvict != nil || l.cold != nil {
+			l.evicted = append(l.evicted, l.entryAt(d.t))
+		}
+		l.times = slices.Delete(l.times, i, i+1)
+		l.del(d.t)
+	}
+}
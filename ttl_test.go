@@ -0,0 +1,53 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+// an item with a TTL goes once the clock passes it, before length evicts it
+func TestAddWithTTL(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistoryWithMin[int](time.Hour, 0, WithClock(clock))
+	evicted := []int{}
+	lg.OnEvict(func(t time.Time, it int) { evicted = append(evicted, it) })
+
+	lg.Add(tm, 0)
+	lg.AddWithTTL(tm.Add(time.Second), 1, time.Duration(5)*time.Second)
+	lg.AddWithTTL(tm.Add(time.Duration(2)*time.Second), 2, time.Minute)
+
+	clock.now = tm.Add(time.Duration(10) * time.Second)
+	lg.Add(clock.now, 3)
+	if lg.Len() != 3 || len(evicted) != 1 || evicted[0] != 1 {
+		t.Error("expected item 1 expired, got", lg.Snapshot(), evicted)
+	}
+
+	// Trim drops expired items without an Add
+	clock.now = tm.Add(time.Duration(2) * time.Minute)
+	if n := lg.Trim(); n != 1 || lg.Len() != 2 {
+		t.Error("expected Trim to expire item 2, got", n, lg.Snapshot())
+	}
+	if err := lg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+// replacing an item drops its TTL and reads auto-trim expired items
+func TestTTLReplaceAndAutoTrim(t *testing.T) {
+	tm := time.Unix(0, 0)
+	clock := &fakeClock{now: tm}
+	lg := MakeHistoryWithMin[int](0, 0, WithClock(clock), WithAutoTrim())
+
+	lg.AddWithTTL(tm, 0, time.Second)
+	lg.AddWithTTL(tm.Add(time.Second), 1, time.Second)
+	lg.AddOrReplace(tm, 10)
+
+	clock.now = tm.Add(time.Minute)
+	if lg.Len() != 1 {
+		t.Error("expected only the replaced item left, got", lg.Snapshot())
+	}
+	if it, _, _ := lg.Oldest(); it != 10 {
+		t.Error("expected the replaced item, got", it)
+	}
+}
@@ -79,11 +79,11 @@ func (l *UniqueHistory) Before(wanted time.Time) (HistoryItem, time.Time, error)
 	defer l.mux.Unlock()
 
 	if len(l.times) == 0 {
-		return nil, time.Now(), fmt.Errorf("empty log")
+		return nil, time.Now(), ErrEmpty
 	}
 
 	if wanted.Before(l.times[0]) {
-		return l.t[l.times[0]], l.times[0], fmt.Errorf("wanted time before log start")
+		return l.t[l.times[0]], l.times[0], ErrBeforeStart
 	}
 
 	then := binsearch(wanted, l.times)
@@ -95,7 +95,7 @@ func (l *UniqueHistory) NumItemsBetween(start time.Time, end time.Time) (int, er
 	defer l.mux.Unlock()
 
 	if len(l.times) == 0 {
-		return 0, fmt.Errorf("empty log")
+		return 0, ErrEmpty
 	}
 
 	startIndex := binsearchindex(start, l.times, 0)
@@ -136,7 +136,7 @@ func (l *UniqueHistory) TimeOf(wanted HistoryItem) (time.Time, error) {
 	defer l.mux.Unlock()
 
 	if t, ok := l.m[wanted]; !ok {
-		return time.Now(), fmt.Errorf("not found: %v", wanted)
+		return time.Now(), fmt.Errorf("%w: %v", ErrNotFound, wanted)
 	} else {
 		return t, nil
 	}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// a stored item's value and time, as ordered in a valueIndex
+type valueKey struct {
+	v float64
+	t time.Time
+}
+
+func compareValueKeys(a valueKey, b valueKey) int {
+	if c := cmp.Compare(a.v, b.v); c != 0 {
+		return c
+	}
+	return a.t.Compare(b.t)
+}
+
+// the stored items sorted by value, then time, for ByValueRange. NaN
+// values have no place in the order and are left out.
+type valueIndex struct {
+	keys []valueKey
+}
+
+// O(n) for shifting the greater keys up
+func (x *valueIndex) add(v float64, t time.Time) {
+	if math.IsNaN(v) {
+		return
+	}
+	k := valueKey{v, t}
+	i, _ := slices.BinarySearchFunc(x.keys, k, compareValueKeys)
+	x.keys = slices.Insert(x.keys, i, k)
+}
+
+func (x *valueIndex) remove(v float64, t time.Time) {
+	if i, ok := slices.BinarySearchFunc(x.keys, valueKey{v, t}, compareValueKeys); ok {
+		x.keys = slices.Delete(x.keys, i, i+1)
+	}
+}
+
+// keeps the stored items indexed by valueOf for ByValueRange, which then
+// finds items by value in O(log n) plus the number found rather than by a
+// scan. the index is a second sorted slice, updated wherever times is:
+// every Add, replacement, eviction and removal takes an item out of both,
+// so the two always hold the same items, at an extra O(n) per Add and
+// eviction for keeping it sorted. valueOf must give an item the same value
+// every time. the index starts from the items stored now, nil valueOf
+// drops it.
+func (l *History[T]) IndexValues(valueOf func(it T) float64) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.valueOf = valueOf
+	l.reindex()
+}
+
+// caller holds the lock. rebuilds the value index from times
+func (l *History[T]) reindex() {
+	if l.valueOf == nil {
+		l.byValue = nil
+		return
+	}
+	keys := make([]valueKey, 0, len(l.times))
+	for _, t := range l.times {
+		if v := l.valueOf(l.t[t]); !math.IsNaN(v) {
+			keys = append(keys, valueKey{v, t})
+		}
+	}
+	slices.SortFunc(keys, compareValueKeys)
+	l.byValue = &valueIndex{keys: keys}
+}
+
+// entries whose value, as given to IndexValues, is in [lo, hi], least
+// first and equal values oldest first. ErrNotTracked unless IndexValues
+// was called.
+func (l *History[T]) ByValueRange(lo float64, hi float64) ([]Entry[T], error) {
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	if l.byValue == nil {
+		return nil, ErrNotTracked
+	}
+	keys := l.byValue.keys
+	i, _ := slices.BinarySearchFunc(keys, lo, func(k valueKey, lo float64) int { return cmp.Compare(k.v, lo) })
+	var entries []Entry[T]
+	for ; i < len(keys) && keys[i].v <= hi; i++ {
+		entries = append(entries, l.entryAt(keys[i].t))
+	}
+	return entries, nil
+}
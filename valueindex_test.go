@@ -0,0 +1,45 @@
+package history
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// ByValueRange finds items by value, following evictions and replacements
+func TestByValueRange(t *testing.T) {
+	lg := MakeHistoryWithCapacity[int](6)
+	if _, err := lg.ByValueRange(0, 1); !errors.Is(err, ErrNotTracked) {
+		t.Error("expected not tracked, got", err)
+	}
+	tm := time.Unix(0, 0)
+	for i, v := range []int{5, 1, 9, 3, 7, 3} {
+		lg.Add(seconds(tm, i), v)
+	}
+	lg.IndexValues(func(it int) float64 { return float64(it) })
+
+	values := func(lo float64, hi float64) []int {
+		entries, _ := lg.ByValueRange(lo, hi)
+		var got []int
+		for _, e := range entries {
+			got = append(got, e.Item)
+		}
+		return got
+	}
+	if got := values(3, 7); !slices.Equal(got, []int{3, 3, 5, 7}) {
+		t.Error("expected 3, 3, 5, 7, got", got)
+	}
+
+	lg.Add(seconds(tm, 6), 4)          // evicts the 5
+	lg.AddOrReplace(seconds(tm, 3), 8) // replaces a 3
+	if got := values(3, 8); !slices.Equal(got, []int{3, 4, 7, 8}) {
+		t.Error("expected the index to follow the changes, got", got)
+	}
+	if entries, _ := lg.ByValueRange(3, 3); len(entries) != 1 || !entries[0].Time.Equal(seconds(tm, 5)) {
+		t.Error("expected the remaining 3 at 5s, got", entries)
+	}
+	if got := values(10, 20); len(got) != 0 {
+		t.Error("expected nothing above 9, got", got)
+	}
+}
@@ -0,0 +1,53 @@
+package history
+
+import (
+	"time"
+)
+
+// Add for an item standing for weight observations, such as a batch of
+// requests, counted by WeightedAvgBetween with that weight. items stored
+// any other way weigh 1, and replacing an item resets its weight to 1.
+// weights are not kept by the encoders.
+func (l *History[T]) AddWeighted(t time.Time, it T, weight float64) (Entry[T], error) {
+	l.mux.Lock()
+	defer l.unlock()
+
+	e, kept, err := l.insert("AddWeighted", l.stored(l.stamp(t)), it)
+	if kept && weight != 1 {
+		if l.weights == nil {
+			l.weights = make(map[time.Time]float64)
+		}
+		l.weights[e.Time] = weight
+	}
+	return e, err
+}
+
+// caller holds the lock. weight of the item stored at t
+func (l *History[T]) weight(t time.Time) float64 {
+	if w, ok := l.weights[t]; ok {
+		return w
+	}
+	return 1
+}
+
+// mean of valueOf of the items in the from, to window, each weighted by
+// the weight it was added with, so the weighted sum is divided by the total
+// weight rather than the count. ErrNoValues if the window is empty or its
+// weights sum to 0.
+func (l *History[T]) WeightedAvgBetween(from time.Time, to time.Time, valueOf func(it T) float64) (_ float64, err error) {
+	defer l.catch(&err)
+	l.rlock()
+	defer l.mux.RUnlock()
+
+	var sum, total float64
+	lo, hi := l.window(from, to)
+	for _, t := range l.times[lo:hi] {
+		w := l.weight(t)
+		sum += w * valueOf(l.t[t])
+		total += w
+	}
+	if total == 0 {
+		return 0, ErrNoValues
+	}
+	return sum / total, nil
+}
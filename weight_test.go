@@ -0,0 +1,33 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// weighted items count for their weight, plain ones for 1
+func TestWeightedAvgBetween(t *testing.T) {
+	lg := MakeHistory[float64](time.Hour)
+	tm := time.Unix(0, 0)
+	id := func(v float64) float64 { return v }
+	lg.AddWeighted(tm, 10, 3)
+	lg.Add(tm.Add(time.Second), 2)
+
+	if avg, err := lg.WeightedAvgBetween(tm, tm.Add(time.Minute), id); err != nil || avg != 8 {
+		t.Error("expected (3*10 + 2) / 4, got", avg, err)
+	}
+
+	lg.AddOrReplace(tm, 10)
+	if avg, _ := lg.WeightedAvgBetween(tm, tm.Add(time.Minute), id); avg != 6 {
+		t.Error("expected a replaced item to weigh 1, got", avg)
+	}
+
+	lg.AddWeighted(tm.Add(2*time.Second), 5, 0)
+	if _, err := lg.WeightedAvgBetween(tm.Add(2*time.Second), tm.Add(time.Minute), id); !errors.Is(err, ErrNoValues) {
+		t.Error("expected no values for a zero total weight, got", err)
+	}
+	if _, err := lg.AddWeighted(tm, 1, 2); !errors.Is(err, ErrDuplicate) {
+		t.Error("expected duplicate error, got", err)
+	}
+}